@@ -0,0 +1,118 @@
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// BodyTooLargeError is returned by BindJSON, FormValue, FormFile and the multipart readers when the body
+// exceeds the limit of BodyLimit or UploadLimits.MaxBytes. Context.Error responds it with 413.
+type BodyTooLargeError struct {
+	Limit int64
+	err   error
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return "request body too large, the limit is " + strconv.FormatInt(e.Limit, 10) + " bytes"
+}
+
+func (e *BodyTooLargeError) Unwrap() error {
+	return e.err
+}
+
+// bodyError converts the error of reading a limited body to *BodyTooLargeError, other errors are kept
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &BodyTooLargeError{Limit: maxBytesErr.Limit, err: err}
+	}
+	return err
+}
+
+// BodyLimit limits the request body to n bytes. A body whose Content-Length is over the limit is responded 413
+// by the error handler before the handler of the route runs. A chunked body fails when read beyond the limit with
+// *BodyTooLargeError, so that the handler can respond it by Context.Error.
+// A BodyLimit inside another one, e.g. on a Group or wrapping the handler of a route, overrides the limit, larger
+// or smaller. Wrap the handler with BodyLimit directly for a per-route limit, e.g.
+//
+//	h.Post("/upload", BodyLimit(100<<20)(handler))
+func BodyLimit(n int64) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		// the declared length is checked by the innermost BodyLimit wrapping the handler of a route
+		return limitBody(n, next, !madeByBodyLimit(next))
+	}
+}
+
+// limitBody is the handler made by BodyLimit, last tells whether next is not made by BodyLimit too
+func limitBody(n int64, next HandleFunc, last bool) HandleFunc {
+	return func(ctx *Context) {
+		if ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+			next(ctx)
+			return
+		}
+		if ctx.rawBody == nil {
+			ctx.rawBody = ctx.Req.Body
+		}
+		body := &limitedBody{
+			ReadCloser: http.MaxBytesReader(ctx.Resp, ctx.rawBody, n),
+			limit:      n,
+			declared:   ctx.Req.ContentLength,
+		}
+		ctx.Req.Body, ctx.bodyLimit = body, body
+		if ctx.inRoute && last && body.exceeded(ctx) {
+			return
+		}
+		next(ctx)
+	}
+}
+
+// bodyLimitCode is the code of the handlers made by BodyLimit, all of them share it
+var bodyLimitCode = reflect.ValueOf(limitBody(0, nil, false)).Pointer()
+
+// madeByBodyLimit reports whether handler is made by BodyLimit
+func madeByBodyLimit(handler HandleFunc) bool {
+	return handler != nil && reflect.ValueOf(handler).Pointer() == bodyLimitCode
+}
+
+// limitedBody fails early if the declared length is over the limit
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	declared int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.declared > b.limit {
+		return 0, &http.MaxBytesError{Limit: b.limit}
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// exceeded responds 413 if the declared length is over the limit, and reports whether it did
+func (b *limitedBody) exceeded(ctx *Context) bool {
+	if b.declared <= b.limit {
+		return false
+	}
+	ctx.Error(&BodyTooLargeError{Limit: b.limit, err: &http.MaxBytesError{Limit: b.limit}})
+	return true
+}
+
+// checkBodyLimit responds 413 instead of running the handler if the declared length of the body is over the limit.
+// It runs right before the handler of a route rather than in BodyLimit, so that an inner BodyLimit can still
+// override the limit. A handler wrapped by BodyLimit is left to it.
+func checkBodyLimit(handler HandleFunc) HandleFunc {
+	if handler == nil {
+		return nil
+	}
+	wrapped := madeByBodyLimit(handler)
+	return func(ctx *Context) {
+		ctx.inRoute = true
+		if body := ctx.bodyLimit; !wrapped && body != nil && body.exceeded(ctx) {
+			return
+		}
+		handler(ctx)
+	}
+}
@@ -0,0 +1,185 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test: bodies over the limit get 413, malformed ones are told apart
+func TestBodyLimit(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(BodyLimit(16)))
+	bindErr := func(ctx *Context, err error) {
+		var tooLarge *BodyTooLargeError
+		if errors.As(err, &tooLarge) {
+			ctx.Error(err)
+			return
+		}
+		ctx.Error(NewHTTPError(http.StatusBadRequest, "malformed"))
+	}
+	h.Post("/json", func(ctx *Context) {
+		var val map[string]string
+		if err := ctx.BindJSON(&val); err != nil {
+			bindErr(ctx, err)
+			return
+		}
+		ctx.Resp.Write([]byte(val["a"]))
+	})
+	h.Post("/form", func(ctx *Context) {
+		val, err := ctx.FormValue("a")
+		if err != nil {
+			bindErr(ctx, err)
+			return
+		}
+		ctx.Resp.Write([]byte(val))
+	})
+	h.Group("/import", BodyLimit(1024)).Post("/", func(ctx *Context) {
+		file, err := ctx.FormFile("file")
+		if err != nil {
+			bindErr(ctx, err)
+			return
+		}
+		ctx.Resp.Write([]byte(file.Filename))
+	})
+
+	multipartBody := func(size int) (string, string) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, _ := w.CreateFormFile("file", "a.txt")
+		part.Write(bytes.Repeat([]byte("a"), size))
+		w.Close()
+		return buf.String(), w.FormDataContentType()
+	}
+	smallUpload, uploadType := multipartBody(100)
+	largeUpload, _ := multipartBody(2000)
+
+	testCases := []struct {
+		caseName    string
+		path        string
+		contentType string
+		body        string
+		// hide the Content-Length, so that the body is read until the limit
+		chunked  bool
+		wantCode int
+		wantBody string
+	}{
+		{caseName: "JSON", path: "/json", body: `{"a":"b"}`, wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Malformed JSON", path: "/json", body: `{"a":`, wantCode: http.StatusBadRequest, wantBody: "malformed\n"},
+		{caseName: "Content-Length over", path: "/json", body: `{"a":"0123456789abcdef"}`,
+			wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+		{caseName: "Chunked JSON over", path: "/json", body: `{"a":"0123456789abcdef"}`, chunked: true,
+			wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+		{caseName: "Form", path: "/form", contentType: "application/x-www-form-urlencoded", body: "a=b",
+			wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Chunked form over", path: "/form", contentType: "application/x-www-form-urlencoded",
+			body: "a=0123456789abcdef", chunked: true, wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+		{caseName: "Larger by group", path: "/import", contentType: uploadType, body: smallUpload,
+			wantCode: http.StatusOK, wantBody: "a.txt"},
+		{caseName: "Chunked upload over", path: "/import", contentType: uploadType, body: largeUpload, chunked: true,
+			wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tc.body)
+			if tc.chunked {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+// Test: streamed parts report the limit too
+func TestBodyLimit_MultipartReader(t *testing.T) {
+	var readErr error
+	h := NewHTTPServer(ServerWithMiddleware(BodyLimit(1024)))
+	h.Post("/upload", func(ctx *Context) {
+		mr, err := ctx.MultipartReader()
+		require.NoError(t, err)
+		part, err := mr.NextPart()
+		if err == nil {
+			_, err = io.Copy(io.Discard, part)
+		}
+		readErr = err
+	})
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreateFormFile("file", "a.txt")
+	part.Write(bytes.Repeat([]byte("a"), 4096))
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.MultiReader(&buf))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	var tooLarge *BodyTooLargeError
+	require.ErrorAs(t, readErr, &tooLarge)
+	assert.Equal(t, int64(1024), tooLarge.Limit)
+}
+
+// Test: a declared length over the limit is responded 413 without running the handler
+func TestBodyLimit_Declared(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(BodyLimit(16)))
+	var ran bool
+	handler := func(ctx *Context) {
+		ran = true
+		ctx.Resp.Write([]byte("ok"))
+	}
+	h.Post("/ignore", handler)
+	h.Group("/large", BodyLimit(1024)).Post("/", handler)
+	h.Post("/upload", BodyLimit(1024)(handler))
+	h.Post("/small", BodyLimit(1024)(BodyLimit(8)(handler)))
+
+	testCases := []struct {
+		caseName string
+		path     string
+		chunked  bool
+		wantCode int
+		wantBody string
+		wantRan  bool
+	}{
+		{caseName: "Declared over", path: "/ignore", wantCode: http.StatusRequestEntityTooLarge,
+			wantBody: "Request Entity Too Large\n"},
+		// known only when read
+		{caseName: "Chunked", path: "/ignore", chunked: true, wantCode: http.StatusOK, wantBody: "ok", wantRan: true},
+		{caseName: "Larger by group", path: "/large", wantCode: http.StatusOK, wantBody: "ok", wantRan: true},
+		{caseName: "Larger by handler", path: "/upload", wantCode: http.StatusOK, wantBody: "ok", wantRan: true},
+		{caseName: "Smaller inside handler", path: "/small", wantCode: http.StatusRequestEntityTooLarge,
+			wantBody: "Request Entity Too Large\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			ran = false
+			var body io.Reader = strings.NewReader(strings.Repeat("a", 100))
+			if tc.chunked {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantRan, ran)
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package web
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EncodeWriter compresses what is written to it into the underlying writer.
+// Flush writes out what has been compressed so far, for streaming responses.
+type EncodeWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Encoder creates an EncodeWriter writing to w, it is registered by the Content-Encoding name, see CompressConfig
+type Encoder func(w io.Writer) (EncodeWriter, error)
+
+// defaultCompressSkipTypes are the types compressed already, compressing them again wastes CPU
+var defaultCompressSkipTypes = []string{
+	"image/*",
+	"video/*",
+	"audio/*",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+}
+
+// CompressConfig configures the compression middleware
+type CompressConfig struct {
+	// Level is the level of gzip and deflate. Default is their default compression level.
+	Level int
+	// MinLength is the length a body must reach to be compressed. Default is 1024 bytes.
+	// A response flushed before, e.g. a stream, is compressed anyway.
+	MinLength int
+	// Encoders add encodings, or replace gzip and deflate, by the Content-Encoding name, e.g. "zstd"
+	// by an encoder of a third party library
+	Encoders map[string]Encoder
+	// SkipTypes are the media types not compressed, either exact like "application/zip" or a whole type like
+	// "image/*". "image/svg+xml" is compressed unless listed exactly. Default is the common compressed types.
+	SkipTypes []string
+}
+
+// Compress is the response compression middleware. The encoding is negotiated by Accept-Encoding with q-values,
+// the ones added by CompressConfig.Encoders are preferred over gzip and deflate when equally accepted.
+// Responses already encoded, partial, or of SkipTypes are left alone.
+// The response is buffered until MinLength, Flush sends what is buffered and compressed so far.
+func Compress(cfg CompressConfig) Middleware {
+	if cfg.Level == 0 {
+		cfg.Level = flate.DefaultCompression
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 1024
+	}
+	if cfg.SkipTypes == nil {
+		cfg.SkipTypes = defaultCompressSkipTypes
+	}
+	encoders := map[string]Encoder{
+		"gzip": pooledEncoder(func(w io.Writer) (resettableWriter, error) { return gzip.NewWriterLevel(w, cfg.Level) }),
+		// "deflate" of HTTP is the zlib format, not raw deflate
+		"deflate": pooledEncoder(func(w io.Writer) (resettableWriter, error) { return zlib.NewWriterLevel(w, cfg.Level) }),
+	}
+	var preference []string
+	for name, encoder := range cfg.Encoders {
+		name = strings.ToLower(name)
+		if _, ok := encoders[name]; !ok {
+			preference = append(preference, name)
+		}
+		encoders[name] = encoder
+	}
+	sort.Strings(preference)
+	preference = append(preference, "gzip", "deflate")
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			addVary(ctx.Resp.Header(), "Accept-Encoding")
+			encoding := negotiateEncoding(ctx.Req.Header.Get("Accept-Encoding"), preference)
+			if encoding == "" {
+				next(ctx)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: ctx.Resp, cfg: &cfg, encoding: encoding, encoder: encoders[encoding]}
+			ctx.Resp = cw
+			defer func() {
+				ctx.Resp = cw.ResponseWriter
+				cw.close()
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// negotiateEncoding picks the accepted encoding of the highest q-value, ties are broken by preference
+func negotiateEncoding(acceptEncoding string, preference []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qValues := parseQValues(acceptEncoding)
+	best, bestQ := "", 0.0
+	for _, name := range preference {
+		if q := qValueOf(qValues, name); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until it decides whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	cfg         *CompressConfig
+	encoding    string
+	encoder     Encoder
+	code        int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	enc         EncodeWriter // nil if not compressing
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader, cw.code = true, code
+	// informational responses go at once
+	if code < http.StatusOK {
+		cw.wroteHeader = false
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.cfg.MinLength {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends what is buffered, compressing it if the response is compressible whatever its length
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close sends what is left after the handler, a body shorter than MinLength is not compressed
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		return
+	}
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.cfg.MinLength)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
+
+// decide writes the header and the buffered body, compressing if long and compressible
+func (cw *compressWriter) decide(long bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 && header.Get("Content-Encoding") == "" {
+		// Sniff before compressing, the server would sniff the compressed bytes otherwise
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if long && cw.compressible() {
+		enc, err := cw.encoder(cw.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		cw.enc = enc
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		// Ranges are of the identity body
+		header.Del("Accept-Ranges")
+		// The compressed one is another representation
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// compressible checks the status and the headers of the response
+func (cw *compressWriter) compressible() bool {
+	if cw.code < http.StatusOK || cw.code == http.StatusNoContent || cw.code == http.StatusPartialContent ||
+		cw.code == http.StatusNotModified {
+		return false
+	}
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return true
+	}
+	for _, skip := range cw.cfg.SkipTypes {
+		if skip == mediaType {
+			return false
+		}
+		if prefix, ok := strings.CutSuffix(skip, "*"); ok && strings.HasPrefix(mediaType, prefix) &&
+			mediaType != "image/svg+xml" {
+			return false
+		}
+	}
+	return true
+}
+
+// resettableWriter is an EncodeWriter which can be reused, like gzip.Writer and zlib.Writer
+type resettableWriter interface {
+	EncodeWriter
+	Reset(w io.Writer)
+}
+
+// pooledEncoder reuses the writers made by newWriter, they are expensive to allocate
+func pooledEncoder(newWriter func(w io.Writer) (resettableWriter, error)) Encoder {
+	pool := &sync.Pool{}
+	return func(w io.Writer) (EncodeWriter, error) {
+		if rw, ok := pool.Get().(resettableWriter); ok {
+			rw.Reset(w)
+			return &pooledWriter{resettableWriter: rw, pool: pool}, nil
+		}
+		rw, err := newWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &pooledWriter{resettableWriter: rw, pool: pool}, nil
+	}
+}
+
+// pooledWriter returns the writer to the pool on Close
+type pooledWriter struct {
+	resettableWriter
+	pool *sync.Pool
+}
+
+func (pw *pooledWriter) Close() error {
+	err := pw.resettableWriter.Close()
+	pw.pool.Put(pw.resettableWriter)
+	return err
+}
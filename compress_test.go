@@ -0,0 +1,189 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// upperEncoder is a fake encoding for the tests, it upper-cases the body
+type upperEncoder struct {
+	w io.Writer
+}
+
+func (e *upperEncoder) Write(b []byte) (int, error) {
+	return e.w.Write(bytes.ToUpper(b))
+}
+
+func (e *upperEncoder) Flush() error { return nil }
+
+func (e *upperEncoder) Close() error { return nil }
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		r = zr
+	default:
+		return string(body)
+	}
+	decoded, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+// Test: negotiation by Accept-Encoding, small bodies and compressed types are left alone
+func TestCompress(t *testing.T) {
+	large := `{"items":[` + strings.Repeat(`{"name":"item"},`, 100) + `{}]}`
+	h := NewHTTPServer(ServerWithMiddleware(Compress(CompressConfig{MinLength: 256})))
+	h.Get("/json", func(ctx *Context) {
+		ctx.Resp.Header().Set("Content-Type", "application/json")
+		ctx.Resp.Header().Set("ETag", `"v1"`)
+		ctx.Resp.Write([]byte(large[:100]))
+		ctx.Resp.Write([]byte(large[100:]))
+	})
+	h.Get("/small", func(ctx *Context) {
+		ctx.Resp.Write([]byte(`{"ok":true}`))
+	})
+	h.Get("/image", func(ctx *Context) {
+		ctx.Resp.Header().Set("Content-Type", "image/png")
+		ctx.Resp.Write([]byte(large))
+	})
+	h.Get("/encoded", func(ctx *Context) {
+		ctx.Resp.Header().Set("Content-Encoding", "br")
+		ctx.Resp.Write([]byte(large))
+	})
+	h.Get("/sniffed", func(ctx *Context) {
+		ctx.Resp.Write([]byte("<html>" + large + "</html>"))
+	})
+
+	testCases := []struct {
+		caseName       string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       string
+		wantHeader     http.Header
+	}{
+		{caseName: "Gzip", path: "/json", acceptEncoding: "gzip, deflate", wantEncoding: "gzip", wantBody: large,
+			wantHeader: http.Header{"Etag": {`W/"v1"`}, "Content-Length": nil}},
+		{caseName: "Deflate preferred by q", path: "/json", acceptEncoding: "gzip;q=0.5, deflate", wantEncoding: "deflate",
+			wantBody: large},
+		{caseName: "Wildcard", path: "/json", acceptEncoding: "*", wantEncoding: "gzip", wantBody: large},
+		{caseName: "Refused", path: "/json", acceptEncoding: "gzip;q=0, identity", wantBody: large,
+			wantHeader: http.Header{"Etag": {`"v1"`}}},
+		{caseName: "No Accept-Encoding", path: "/json", wantBody: large},
+		{caseName: "Small body", path: "/small", acceptEncoding: "gzip", wantBody: `{"ok":true}`},
+		{caseName: "Compressed type", path: "/image", acceptEncoding: "gzip", wantBody: large},
+		{caseName: "Encoded already", path: "/encoded", acceptEncoding: "gzip", wantEncoding: "br", wantBody: large},
+		{caseName: "Sniffed type", path: "/sniffed", acceptEncoding: "gzip", wantEncoding: "gzip",
+			wantBody:   "<html>" + large + "</html>",
+			wantHeader: http.Header{"Content-Type": {"text/html; charset=utf-8"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantBody, decodeBody(t, tc.wantEncoding, recorder.Body.Bytes()))
+			for key, values := range tc.wantHeader {
+				assert.Equal(t, values, recorder.Header()[key])
+			}
+		})
+	}
+}
+
+// Test: encoders added by name are preferred, unless the client prefers another
+func TestCompress_Encoders(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(Compress(CompressConfig{
+		MinLength: 1,
+		Encoders: map[string]Encoder{
+			"upper": func(w io.Writer) (EncodeWriter, error) {
+				return &upperEncoder{w: w}, nil
+			},
+		},
+	})))
+	h.Get("/", func(ctx *Context) {
+		ctx.Resp.Write([]byte("hello"))
+	})
+
+	testCases := []struct {
+		caseName       string
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{caseName: "Preferred", acceptEncoding: "gzip, upper", wantEncoding: "upper", wantBody: "HELLO"},
+		{caseName: "Lower q", acceptEncoding: "gzip, upper;q=0.1", wantEncoding: "gzip", wantBody: "hello"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantBody, decodeBody(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+// Test: each flushed event can be decoded before the stream ends
+func TestCompress_SSE(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(Compress(CompressConfig{})))
+	sent := make(chan struct{})
+	next := make(chan struct{})
+	h.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE()
+		require.NoError(t, err)
+		defer sse.Close()
+		require.NoError(t, sse.Send("", "", "first"))
+		sent <- struct{}{}
+		<-next
+		require.NoError(t, sse.Send("", "", "second"))
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	require.NoError(t, err)
+	// set by hand, so that the transport does not decompress
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	<-sent
+	gr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	buf := make([]byte, len("data: first\n\n"))
+	_, err = io.ReadFull(gr, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n\n", string(buf))
+
+	close(next)
+	rest, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, "data: second\n\n", string(rest))
+}
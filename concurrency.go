@@ -0,0 +1,206 @@
+package web
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Priority is the class of a request for ConcurrencyLimiter
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	// PriorityCritical requests are never queued nor shed, e.g. health checks, they count in InFlight only
+	PriorityCritical
+)
+
+// ConcurrencyConfig configures a ConcurrencyLimiter
+type ConcurrencyConfig struct {
+	// MaxInFlight is how many requests are served at the same time
+	MaxInFlight int
+	// MaxQueue is how many requests can wait for a slot, the others are shed. 0 sheds at once when full.
+	MaxQueue int
+	// QueueTimeout is how long a request waits before it is shed. 0 waits until the client gives up.
+	QueueTimeout time.Duration
+	// RetryAfter is sent with the shed requests. Default is 1 second.
+	RetryAfter time.Duration
+	// Priority classifies requests, all are PriorityNormal by default. Waiting requests of higher priority
+	// are served first, and take the place of lower ones when the queue is full.
+	Priority func(ctx *Context) Priority
+}
+
+// ConcurrencyLimiter caps the requests in flight, and sheds the load beyond its queue with 503.
+// Use its Middleware on the server for a global cap, or on a Group for the cap of some routes.
+type ConcurrencyLimiter struct {
+	cfg      ConcurrencyConfig
+	mu       sync.Mutex
+	active   int // requests holding a slot
+	critical int // PriorityCritical requests in flight
+	queued   int
+	queues   [PriorityCritical][]*concurrencyWaiter // FIFO per priority below critical
+}
+
+type concurrencyWaiter struct {
+	ready    chan struct{}
+	done     bool // ready is closed
+	admitted bool // a slot is handed over, otherwise it is shed
+}
+
+// NewConcurrencyLimiter constructs a ConcurrencyLimiter
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.MaxInFlight <= 0 {
+		panic("max in flight should be positive")
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	if cfg.Priority == nil {
+		cfg.Priority = func(ctx *Context) Priority {
+			return PriorityNormal
+		}
+	}
+	return &ConcurrencyLimiter{cfg: cfg}
+}
+
+// InFlight is the number of requests being served
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active + l.critical
+}
+
+// Queued is the number of requests waiting for a slot
+func (l *ConcurrencyLimiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
+
+// Middleware limits the requests passing it, shed ones get 503 with Retry-After by the error handler
+//
+//	limiter := NewConcurrencyLimiter(ConcurrencyConfig{
+//		MaxInFlight: 100,
+//		MaxQueue:    200,
+//		Priority: func(ctx *Context) Priority {
+//			if ctx.Req.URL.Path == "/health" {
+//				return PriorityCritical
+//			}
+//			return PriorityNormal
+//		},
+//	})
+//	server.Use(limiter.Middleware())
+func (l *ConcurrencyLimiter) Middleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			prio := l.cfg.Priority(ctx)
+			if prio >= PriorityCritical {
+				l.mu.Lock()
+				l.critical++
+				l.mu.Unlock()
+				defer func() {
+					l.mu.Lock()
+					l.critical--
+					l.mu.Unlock()
+				}()
+				next(ctx)
+				return
+			}
+			if prio < PriorityLow {
+				prio = PriorityLow
+			}
+
+			if !l.acquire(ctx, prio) {
+				ctx.Resp.Header().Set("Retry-After", ceilSeconds(l.cfg.RetryAfter))
+				ctx.Error(NewHTTPError(http.StatusServiceUnavailable, ""))
+				return
+			}
+			defer l.release()
+			next(ctx)
+		}
+	}
+}
+
+// acquire gets a slot, waiting in the queue if needed. It reports false if the request is shed.
+func (l *ConcurrencyLimiter) acquire(ctx *Context, prio Priority) bool {
+	l.mu.Lock()
+	if l.active < l.cfg.MaxInFlight && l.queued == 0 {
+		l.active++
+		l.mu.Unlock()
+		return true
+	}
+	if l.queued >= l.cfg.MaxQueue && !l.evictLocked(prio) {
+		l.mu.Unlock()
+		return false
+	}
+	w := &concurrencyWaiter{ready: make(chan struct{})}
+	l.queues[prio] = append(l.queues[prio], w)
+	l.queued++
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(l.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return w.admitted
+	case <-timeout:
+	case <-ctx.Req.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.done {
+		// handed over a slot or shed right before giving up
+		return w.admitted
+	}
+	l.removeLocked(prio, w)
+	return false
+}
+
+// evictLocked sheds the newest waiter of the lowest priority below prio, to make room for a request of prio
+func (l *ConcurrencyLimiter) evictLocked(prio Priority) bool {
+	for p := PriorityLow; p < prio; p++ {
+		if n := len(l.queues[p]); n > 0 {
+			victim := l.queues[p][n-1]
+			l.removeLocked(p, victim)
+			victim.done = true
+			close(victim.ready)
+			return true
+		}
+	}
+	return false
+}
+
+// release hands the slot over to the first waiter of the highest priority, or frees it
+func (l *ConcurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for p := PriorityCritical - 1; p >= PriorityLow; p-- {
+		if len(l.queues[p]) > 0 {
+			w := l.queues[p][0]
+			l.removeLocked(p, w)
+			w.done, w.admitted = true, true
+			close(w.ready)
+			return
+		}
+	}
+	l.active--
+}
+
+// removeLocked removes w from the queue of prio. l.mu must be held.
+func (l *ConcurrencyLimiter) removeLocked(prio Priority, w *concurrencyWaiter) {
+	queue := l.queues[prio]
+	for i, waiter := range queue {
+		if waiter == w {
+			l.queues[prio] = append(queue[:i], queue[i+1:]...)
+			l.queued--
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test: requests are queued by priority, shed when the queue is full, and critical ones pass
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyConfig{
+		MaxInFlight: 1,
+		MaxQueue:    1,
+		RetryAfter:  2 * time.Second,
+		Priority: func(ctx *Context) Priority {
+			switch ctx.Req.URL.Path {
+			case "/health":
+				return PriorityCritical
+			case "/checkout":
+				return PriorityHigh
+			}
+			return PriorityNormal
+		},
+	})
+	h := NewHTTPServer(ServerWithMiddleware(limiter.Middleware()))
+	entered := make(chan string)
+	unblock := make(chan struct{})
+	block := func(ctx *Context) {
+		entered <- ctx.Req.URL.Path
+		<-unblock
+	}
+	h.Get("/browse", block)
+	h.Get("/checkout", block)
+	h.Get("/health", func(ctx *Context) {
+		ctx.Resp.Write([]byte("ok"))
+	})
+
+	serve := func(path string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+			done <- recorder
+		}()
+		return done
+	}
+	waitQueued := func(n int) {
+		require.Eventually(t, func() bool {
+			return limiter.Queued() == n
+		}, time.Second, time.Millisecond)
+	}
+
+	first := serve("/browse")
+	assert.Equal(t, "/browse", <-entered)
+	queued := serve("/browse")
+	waitQueued(1)
+
+	// the queue is full
+	recorder := <-serve("/browse")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+
+	// a higher priority takes the place
+	checkout := serve("/checkout")
+	recorder = <-queued
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	waitQueued(1)
+
+	// health checks are never shed
+	recorder = <-serve("/health")
+	assert.Equal(t, "ok", recorder.Body.String())
+	assert.Equal(t, 1, limiter.InFlight())
+
+	// the slot is handed over
+	unblock <- struct{}{}
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, "/checkout", <-entered)
+	assert.Equal(t, 0, limiter.Queued())
+	unblock <- struct{}{}
+	assert.Equal(t, http.StatusOK, (<-checkout).Code)
+	assert.Equal(t, 0, limiter.InFlight())
+}
+
+// Test: a request waiting too long is shed
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyConfig{MaxInFlight: 1, MaxQueue: 10, QueueTimeout: 10 * time.Millisecond})
+	h := NewHTTPServer()
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	h.Group("/slow", limiter.Middleware()).Get("/", func(ctx *Context) {
+		entered <- struct{}{}
+		<-unblock
+	})
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-entered
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, 0, limiter.Queued())
+	close(unblock)
+}
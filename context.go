@@ -3,15 +3,30 @@ package web
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 type Context struct {
 	Req        *http.Request
 	Resp       http.ResponseWriter
 	Param      *param
-	urlQueries url.Values // Cache the url queries
+	urlQueries url.Values  // Cache the url queries
+	server     *HTTPServer // the server serving this request
+	// limits of multipart uploads, see UploadLimit
+	uploadLimits *UploadLimits
+	// the multipart form is parsed once, the error of parsing or checking it is kept for the later calls
+	multipartParsed bool
+	multipartErr    error
+	session         *session        // see Sessions
+	csrf            *csrfState      // see CSRF
+	cspNonce        string          // see SecurityHeaders
+	timeout         *timeoutContext // see Timeout
+	rawBody         io.ReadCloser   // the body before BodyLimit
+	bodyLimit       *limitedBody    // the body of the innermost BodyLimit
+	inRoute         bool            // the middlewares of the route have run, see checkBodyLimit
 }
 
 // BindJSON fills val with JSON data
@@ -25,15 +40,21 @@ func (c *Context) BindJSON(val any) error {
 	decoder := json.NewDecoder(c.Req.Body)
 	//decoder.DisallowUnknownFields() // do not allow unknown fields in JSON
 	//decoder.UseNumber() // Use `Number`(string) as the type of numbers
-	return decoder.Decode(val)
+	return bodyError(decoder.Decode(val))
 }
 
-// FormValue gets value of `key` in form data
+// FormValue gets value of `key` in form data, either url-encoded or multipart
 func (c *Context) FormValue(key string) (string, error) {
 	// parsing multiple times is ok
 	err := c.Req.ParseForm()
 	if err != nil {
-		return "", err
+		return "", bodyError(err)
+	}
+	// ParseForm does not read multipart bodies
+	if strings.HasPrefix(c.Req.Header.Get("Content-Type"), "multipart/form-data") {
+		if err = c.parseMultipartForm(); err != nil {
+			return "", err
+		}
 	}
 	// c.Req.Form = params in POST, PUT, PATCH and URL
 	// c.Req.PostForm = params in POST, PUT, PATCH body
@@ -57,6 +78,27 @@ func (c *Context) QueryValue(key string) string {
 }
 
 // PathValue gets the value of path param `key`
+// With ServerWithUseRawPath, the value is already unescaped.
+// The key "*" gets what a trailing wildcard pairs, e.g. "b/c" for route "/a/*" and path "/a/b/c".
 func (c *Context) PathValue(key string) string {
+	if c.Param == nil {
+		return ""
+	}
 	return (*c.Param)[key]
 }
+
+// Render renders the template name with data by the template engine of the server, and responds it as HTML.
+// Nothing is written if rendering fails, so that the caller can respond the error.
+func (c *Context) Render(code int, name string, data any) error {
+	if c.server == nil || c.server.tplEngine == nil {
+		return errors.New("template engine is not set")
+	}
+	page, err := c.server.tplEngine.Render(c.Req.Context(), name, data)
+	if err != nil {
+		return err
+	}
+	c.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Resp.WriteHeader(code)
+	_, err = c.Resp.Write(page)
+	return err
+}
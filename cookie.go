@@ -0,0 +1,273 @@
+package web
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCookie is returned when a signed or encrypted cookie is tampered, or made by unknown keys
+	ErrInvalidCookie = errors.New("invalid cookie")
+	// ErrNoCookieKeys is returned when signing or encrypting cookies without keys, see ServerWithCookieKeys
+	ErrNoCookieKeys = errors.New("cookie keys are not set")
+)
+
+// CookieOption configures a cookie to set
+type CookieOption func(cookie *http.Cookie)
+
+// CookieWithPath sets the path of cookie. Default is "/".
+func CookieWithPath(path string) CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.Path = path
+	}
+}
+
+// CookieWithDomain sets the domain of cookie
+func CookieWithDomain(domain string) CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.Domain = domain
+	}
+}
+
+// CookieWithMaxAge sets how long the cookie lives. Zero or negative deletes the cookie.
+func CookieWithMaxAge(maxAge time.Duration) CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.MaxAge = int(maxAge / time.Second)
+		if cookie.MaxAge <= 0 {
+			cookie.MaxAge = -1
+		}
+	}
+}
+
+// CookieWithSameSite sets the SameSite attribute. Default is http.SameSiteLaxMode.
+func CookieWithSameSite(sameSite http.SameSite) CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.SameSite = sameSite
+	}
+}
+
+// CookieInsecure allows the cookie over plain HTTP, e.g. for local development
+func CookieInsecure() CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.Secure = false
+	}
+}
+
+// CookieScriptable allows scripts to read the cookie, i.e. without HttpOnly
+func CookieScriptable() CookieOption {
+	return func(cookie *http.Cookie) {
+		cookie.HttpOnly = false
+	}
+}
+
+// Cookie gets the value of cookie name, http.ErrNoCookie if not present
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// SetCookie sets a cookie with secure defaults: Path=/, HttpOnly, Secure and SameSite=Lax
+func (c *Context) SetCookie(name, value string, opts ...CookieOption) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		opt(cookie)
+	}
+	http.SetCookie(c.Resp, cookie)
+}
+
+// DeleteCookie tells the client to delete cookie name
+func (c *Context) DeleteCookie(name string, opts ...CookieOption) {
+	c.SetCookie(name, "", append(opts, CookieWithMaxAge(0))...)
+}
+
+// SetSignedCookie sets a cookie whose value is readable by the client but cannot be tampered
+func (c *Context) SetSignedCookie(name, value string, opts ...CookieOption) error {
+	keys := c.cookieKeys()
+	if keys == nil {
+		return ErrNoCookieKeys
+	}
+	c.SetCookie(name, keys.sign(name, value), opts...)
+	return nil
+}
+
+// SignedCookie gets the value of a cookie set by SetSignedCookie. The signature is verified by every key.
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys := c.cookieKeys()
+	if keys == nil {
+		return "", ErrNoCookieKeys
+	}
+	signed, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return keys.verify(name, signed)
+}
+
+// SetEncryptedCookie sets a cookie whose value is encrypted by AES-GCM, neither readable nor tamperable
+func (c *Context) SetEncryptedCookie(name, value string, opts ...CookieOption) error {
+	keys := c.cookieKeys()
+	if keys == nil {
+		return ErrNoCookieKeys
+	}
+	encrypted, err := keys.encrypt(name, value)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(name, encrypted, opts...)
+	return nil
+}
+
+// EncryptedCookie gets the value of a cookie set by SetEncryptedCookie. Every key is tried to decrypt.
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	keys := c.cookieKeys()
+	if keys == nil {
+		return "", ErrNoCookieKeys
+	}
+	encrypted, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return keys.decrypt(name, encrypted)
+}
+
+func (c *Context) cookieKeys() *cookieKeyRing {
+	if c.server == nil {
+		return nil
+	}
+	return c.server.cookieKeys
+}
+
+// ServerWithCookieKeys sets the secrets of signed and encrypted cookies, each should have at least 32 random bytes.
+// The first one signs and encrypts, all of them verify and decrypt. To rotate, put the new secret first, and
+// drop the old one after the cookies made by it have expired.
+func ServerWithCookieKeys(secrets ...[]byte) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.cookieKeys = newCookieKeyRing(secrets)
+	}
+}
+
+// cookieKeyRing keeps the keys derived from the secrets
+type cookieKeyRing struct {
+	keys []cookieKey
+}
+
+type cookieKey struct {
+	signKey []byte
+	aead    cipher.AEAD
+}
+
+func newCookieKeyRing(secrets [][]byte) *cookieKeyRing {
+	if len(secrets) == 0 {
+		panic("no cookie secrets")
+	}
+	ring := &cookieKeyRing{}
+	for _, secret := range secrets {
+		if len(secret) < 32 {
+			panic("cookie secret should have at least 32 bytes")
+		}
+		// Different keys for signing and encrypting, derived from the same secret
+		block, err := aes.NewCipher(deriveKey(secret, "web cookie encrypt"))
+		if err != nil {
+			panic(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+		ring.keys = append(ring.keys, cookieKey{
+			signKey: deriveKey(secret, "web cookie sign"),
+			aead:    aead,
+		})
+	}
+	return ring
+}
+
+// deriveKey derives a 32 bytes key for purpose
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// sign makes "base64(value).base64(mac)". The name is signed along, so that the value cannot be moved to
+// another cookie.
+func (ring *cookieKeyRing) sign(name, value string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(ring.keys[0].signKey, name, encoded))
+}
+
+func (ring *cookieKeyRing) verify(name, signed string) (string, error) {
+	encoded, encodedMAC, ok := strings.Cut(signed, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range ring.keys {
+		if hmac.Equal(mac, cookieMAC(key.signKey, name, encoded)) {
+			value, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func cookieMAC(key []byte, name, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// encrypt makes "base64(nonce + ciphertext)", with the name as additional data
+func (ring *cookieKeyRing) encrypt(name, value string) (string, error) {
+	aead := ring.keys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (ring *cookieKeyRing) decrypt(name, encrypted string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range ring.keys {
+		nonceSize := key.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			return "", ErrInvalidCookie
+		}
+		value, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+		if err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var (
+	oldCookieSecret = bytes.Repeat([]byte("o"), 32)
+	newCookieSecret = bytes.Repeat([]byte("n"), 32)
+)
+
+// Test: set cookies with secure defaults
+func TestContext_SetCookie(t *testing.T) {
+	h := NewHTTPServer()
+	h.Get("/set", func(ctx *Context) {
+		ctx.SetCookie("a", "1")
+		ctx.SetCookie("b", "2", CookieInsecure(), CookieScriptable(), CookieWithPath("/b"),
+			CookieWithDomain("example.com"), CookieWithMaxAge(time.Hour), CookieWithSameSite(http.SameSiteStrictMode))
+		ctx.DeleteCookie("c")
+	})
+	var got string
+	var err error
+	h.Get("/get", func(ctx *Context) {
+		got, err = ctx.Cookie("a")
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/set", nil))
+	assert.Equal(t, []string{
+		"a=1; Path=/; HttpOnly; Secure; SameSite=Lax",
+		"b=2; Path=/b; Domain=example.com; Max-Age=3600; SameSite=Strict",
+		"c=; Path=/; Max-Age=0; HttpOnly; Secure; SameSite=Lax",
+	}, recorder.Header().Values("Set-Cookie"))
+
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.AddCookie(&http.Cookie{Name: "a", Value: "1"})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", got)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/get", nil))
+	assert.ErrorIs(t, err, http.ErrNoCookie)
+}
+
+// Test: signed and encrypted cookies, with key rotation
+func TestContext_SignedAndEncryptedCookie(t *testing.T) {
+	oldServer := NewHTTPServer(ServerWithCookieKeys(oldCookieSecret))
+	rotatedServer := NewHTTPServer(ServerWithCookieKeys(newCookieSecret, oldCookieSecret))
+	newServer := NewHTTPServer(ServerWithCookieKeys(newCookieSecret))
+	var signed, encrypted string
+	var signedErr, encryptedErr error
+	for _, h := range []*HTTPServer{oldServer, rotatedServer, newServer} {
+		h.Get("/set", func(ctx *Context) {
+			require.NoError(t, ctx.SetSignedCookie("signed", "uid=42"))
+			require.NoError(t, ctx.SetEncryptedCookie("encrypted", "secret state"))
+		})
+		h.Get("/get", func(ctx *Context) {
+			signed, signedErr = ctx.SignedCookie("signed")
+			encrypted, encryptedErr = ctx.EncryptedCookie("encrypted")
+		})
+	}
+
+	// set by the old key
+	recorder := httptest.NewRecorder()
+	oldServer.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/set", nil))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.NotContains(t, cookies[1].Value, "secret")
+
+	read := func(h *HTTPServer, cookies ...*http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "/get", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the rotated server still reads cookies of the old key
+	read(rotatedServer, cookies...)
+	assert.NoError(t, signedErr)
+	assert.Equal(t, "uid=42", signed)
+	assert.NoError(t, encryptedErr)
+	assert.Equal(t, "secret state", encrypted)
+
+	// the old key dropped
+	read(newServer, cookies...)
+	assert.ErrorIs(t, signedErr, ErrInvalidCookie)
+	assert.ErrorIs(t, encryptedErr, ErrInvalidCookie)
+
+	// tampered, or moved to another cookie
+	read(oldServer,
+		&http.Cookie{Name: "signed", Value: "dWlkPTQz." + cookies[0].Value[len("dWlkPTQy."):]},
+		&http.Cookie{Name: "encrypted", Value: cookies[0].Value})
+	assert.ErrorIs(t, signedErr, ErrInvalidCookie)
+	assert.ErrorIs(t, encryptedErr, ErrInvalidCookie)
+	read(oldServer, &http.Cookie{Name: "encrypted", Value: "a"})
+	assert.ErrorIs(t, encryptedErr, ErrInvalidCookie)
+
+	// no keys
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil), Resp: httptest.NewRecorder()}
+	assert.ErrorIs(t, ctx.SetSignedCookie("a", "b"), ErrNoCookieKeys)
+	_, err := ctx.EncryptedCookie("a")
+	assert.ErrorIs(t, err, ErrNoCookieKeys)
+
+	assert.Panicsf(t, func() {
+		NewHTTPServer(ServerWithCookieKeys([]byte("short")))
+	}, "Short secret")
+}
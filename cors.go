@@ -0,0 +1,126 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowOrigins are the allowed origins: exact ones like "https://example.com", wildcard subdomains like
+	// "https://*.example.com", or "*" for any origin
+	AllowOrigins []string
+	// AllowOriginFunc allows an origin not in AllowOrigins if it returns true
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods are the methods allowed by preflight requests. Default is the methods having a route for the path.
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed by preflight requests.
+	// Default is the headers asked by the preflight request.
+	AllowHeaders []string
+	// ExposeHeaders are the response headers readable by scripts besides the CORS-safelisted ones
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and authorization. The origin is echoed instead of "*" then, as required.
+	AllowCredentials bool
+	// MaxAge is how long a preflight result can be cached by browsers, not sent if 0
+	MaxAge time.Duration
+}
+
+// CORS is the Cross-Origin Resource Sharing middleware.
+// Preflight requests are answered with 204 before routing, the handlers never see them.
+// Requests from disallowed origins are served without CORS headers, so that browsers block them.
+func CORS(cfg CORSConfig) Middleware {
+	anyOrigin := false
+	for _, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+	}
+	// The response depends on Origin unless "*" is sent to everyone
+	varyOrigin := !anyOrigin || cfg.AllowCredentials
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			header := ctx.Resp.Header()
+			preflight := ctx.Req.Method == http.MethodOptions && ctx.Req.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				addVary(header, "Access-Control-Request-Method", "Access-Control-Request-Headers")
+			}
+			if varyOrigin {
+				addVary(header, "Origin")
+			}
+
+			origin := ctx.Req.Header.Get("Origin")
+			allowed := origin != "" && (anyOrigin || cfg.allowOrigin(origin))
+			if allowed {
+				if anyOrigin && !cfg.AllowCredentials {
+					header.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					header.Set("Access-Control-Allow-Origin", origin)
+				}
+				if cfg.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if allowed && len(cfg.ExposeHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposeHeaders, ", "))
+				}
+				next(ctx)
+				return
+			}
+
+			methods := cfg.AllowMethods
+			if methods == nil && ctx.server != nil {
+				methods = ctx.server.allowedMethods(ctx.Req)
+				if len(methods) == 0 {
+					// Nothing to share on this path, let the router respond 404
+					next(ctx)
+					return
+				}
+			}
+			if allowed {
+				header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				if len(cfg.AllowHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowHeaders, ", "))
+				} else if reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				if cfg.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+				}
+			}
+			ctx.Resp.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// allowOrigin checks origin against AllowOrigins and AllowOriginFunc
+func (cfg *CORSConfig) allowOrigin(origin string) bool {
+	for _, allowed := range cfg.AllowOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// "https://*.example.com" matches "https://api.example.com", but not "https://example.com"
+		if scheme, domain, ok := strings.Cut(allowed, "*."); ok {
+			prefix, suffix := strings.ToLower(scheme), strings.ToLower("."+domain)
+			lower := strings.ToLower(origin)
+			if strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) &&
+				len(lower) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+	return cfg.AllowOriginFunc != nil && cfg.AllowOriginFunc(origin)
+}
+
+// addVary adds values to the Vary header, skipping the ones already there
+func addVary(header http.Header, values ...string) {
+	for _, value := range values {
+		if !headerHasToken(header, "Vary", value) {
+			header.Add("Vary", value)
+		}
+	}
+}
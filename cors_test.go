@@ -0,0 +1,175 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: preflight and actual requests by origin
+func TestCORS(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(CORS(CORSConfig{
+		AllowOrigins:     []string{"https://example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".test") },
+		ExposeHeaders:    []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})))
+	h.Get("/users/:id", func(ctx *Context) {
+		ctx.Resp.Write([]byte("user"))
+	})
+	h.AddRoute(http.MethodDelete, "/users/:id", func(ctx *Context) {})
+
+	testCases := []struct {
+		caseName   string
+		method     string
+		path       string
+		header     http.Header
+		wantCode   int
+		wantHeader http.Header
+		wantBody   string
+	}{
+		{
+			caseName: "Same origin",
+			method:   http.MethodGet,
+			path:     "/users/1",
+			wantCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Vary": {"Origin"},
+			},
+			wantBody: "user",
+		},
+		{
+			caseName: "Exact origin",
+			method:   http.MethodGet,
+			path:     "/users/1",
+			header:   http.Header{"Origin": {"https://example.com"}},
+			wantCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Vary":                             {"Origin"},
+				"Access-Control-Allow-Origin":      {"https://example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Total"},
+			},
+			wantBody: "user",
+		},
+		{
+			caseName: "Disallowed origin",
+			method:   http.MethodGet,
+			path:     "/users/1",
+			header:   http.Header{"Origin": {"https://example.org"}},
+			wantCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Vary": {"Origin"},
+			},
+			wantBody: "user",
+		},
+		{
+			caseName: "Preflight by wildcard subdomain",
+			method:   http.MethodOptions,
+			path:     "/users/1",
+			header: http.Header{
+				"Origin":                         {"https://api.example.org"},
+				"Access-Control-Request-Method":  {"DELETE"},
+				"Access-Control-Request-Headers": {"X-Token"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Vary":                             {"Access-Control-Request-Method", "Access-Control-Request-Headers", "Origin"},
+				"Access-Control-Allow-Origin":      {"https://api.example.org"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"DELETE, GET"},
+				"Access-Control-Allow-Headers":     {"X-Token"},
+				"Access-Control-Max-Age":           {"600"},
+			},
+		},
+		{
+			caseName: "Preflight by predicate",
+			method:   http.MethodOptions,
+			path:     "/users/1",
+			header: http.Header{
+				"Origin":                        {"http://localhost.test"},
+				"Access-Control-Request-Method": {"GET"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Vary":                             {"Access-Control-Request-Method", "Access-Control-Request-Headers", "Origin"},
+				"Access-Control-Allow-Origin":      {"http://localhost.test"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"DELETE, GET"},
+				"Access-Control-Max-Age":           {"600"},
+			},
+		},
+		{
+			caseName: "Preflight from disallowed origin",
+			method:   http.MethodOptions,
+			path:     "/users/1",
+			header: http.Header{
+				"Origin":                        {"https://example.org"},
+				"Access-Control-Request-Method": {"GET"},
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Vary": {"Access-Control-Request-Method", "Access-Control-Request-Headers", "Origin"},
+			},
+		},
+		{
+			caseName: "Preflight of unknown path",
+			method:   http.MethodOptions,
+			path:     "/posts/1",
+			header: http.Header{
+				"Origin":                        {"https://example.com"},
+				"Access-Control-Request-Method": {"GET"},
+			},
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for key, values := range tc.header {
+				req.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode == http.StatusNotFound {
+				return
+			}
+			for key := range recorder.Header() {
+				if strings.HasPrefix(key, "Access-Control-") || key == "Vary" {
+					assert.Equal(t, tc.wantHeader[key], recorder.Header()[key], key)
+				}
+			}
+			for key, values := range tc.wantHeader {
+				assert.Equal(t, values, recorder.Header()[key], key)
+			}
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+// Test: any origin gets "*" without credentials, and the response does not vary
+func TestCORS_AnyOrigin(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(CORS(CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{http.MethodGet, http.MethodPost},
+		AllowHeaders: []string{"Content-Type"},
+	})))
+	h.Get("/", func(ctx *Context) {})
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", recorder.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.NotContains(t, recorder.Header().Values("Vary"), "Origin")
+}
@@ -0,0 +1,209 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// csrfTokenLen is the length of a CSRF token in bytes
+const csrfTokenLen = 32
+
+// CSRFConfig configures the CSRF middleware
+type CSRFConfig struct {
+	// UseSession keeps the token in the session (synchronizer token), the Sessions middleware must run before.
+	// Otherwise the token is kept in a cookie, and the request must submit the same one (double-submit cookie).
+	UseSession bool
+	// CookieName is the cookie of the token for double-submit. Default is "csrf_token".
+	CookieName string
+	// CookieOptions are applied to the token cookie. It is HttpOnly by default, scripts should read the token
+	// from the page, e.g. a meta tag, rather than the cookie.
+	CookieOptions []CookieOption
+	// FieldName is the form field of the token. Default is "csrf_token".
+	FieldName string
+	// HeaderName is the header of the token, used by scripts. Default is "X-CSRF-Token".
+	HeaderName string
+	// TrustedOrigins are the origins allowed besides the same origin, e.g. "https://admin.example.com"
+	TrustedOrigins []string
+}
+
+// CSRF is the Cross-Site Request Forgery protection middleware. Safe methods (GET, HEAD, OPTIONS, TRACE) pass,
+// others are rejected with 403 unless:
+//   - the browser tells the request is not cross-origin by Sec-Fetch-Site, or Origin if the former is absent
+//   - and the token of Context.CSRFToken is submitted by the header or the form field
+//
+// A url-encoded form body is parsed to find the token. A multipart body is not, so that the upload limits of
+// the route apply when the handler parses it: multipart forms, e.g. uploads, must send the token by the header.
+func CSRF(cfg CSRFConfig) Middleware {
+	if cfg.CookieName == "" {
+		cfg.CookieName = "csrf_token"
+	}
+	if cfg.FieldName == "" {
+		cfg.FieldName = "csrf_token"
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = "X-CSRF-Token"
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.csrf = &csrfState{cfg: &cfg, ctx: ctx}
+			switch ctx.Req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next(ctx)
+				return
+			}
+			if !cfg.sameOrigin(ctx.Req) {
+				http.Error(ctx.Resp, "Forbidden - cross-origin request", http.StatusForbidden)
+				return
+			}
+			if !ctx.csrf.verify(cfg.submittedToken(ctx)) {
+				http.Error(ctx.Resp, "Forbidden - invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// CSRFToken gets the token to submit with the next unsafe request, e.g. in a hidden field of a form.
+// It is masked differently on every call, so that it cannot be guessed from compressed responses (BREACH).
+// Empty without the CSRF middleware.
+func (c *Context) CSRFToken() string {
+	if c.csrf == nil {
+		return ""
+	}
+	token := c.csrf.token()
+	if token == nil {
+		return ""
+	}
+	return maskCSRFToken(token)
+}
+
+// csrfState is the CSRF token of a request
+type csrfState struct {
+	cfg    *CSRFConfig
+	ctx    *Context
+	cached []byte
+}
+
+// token gets the token of the client, a new one is generated and kept if there is none
+func (s *csrfState) token() []byte {
+	if s.cached != nil {
+		return s.cached
+	}
+	if token := s.stored(); token != nil {
+		s.cached = token
+		return token
+	}
+
+	token := make([]byte, csrfTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return nil
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+	if s.cfg.UseSession {
+		sess := s.ctx.Session()
+		if sess == nil {
+			panic("CSRF with UseSession requires the Sessions middleware")
+		}
+		sess.Set(s.cfg.CookieName, encoded)
+	} else {
+		s.ctx.SetCookie(s.cfg.CookieName, encoded, s.cfg.CookieOptions...)
+	}
+	s.cached = token
+	return token
+}
+
+// stored gets the token kept in the session or the cookie, nil if none
+func (s *csrfState) stored() []byte {
+	var encoded string
+	if s.cfg.UseSession {
+		if sess := s.ctx.Session(); sess != nil {
+			value, _ := sess.Get(s.cfg.CookieName)
+			encoded, _ = value.(string)
+		}
+	} else {
+		encoded, _ = s.ctx.Cookie(s.cfg.CookieName)
+	}
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != csrfTokenLen {
+		return nil
+	}
+	return token
+}
+
+// verify compares the submitted masked token with the stored one
+func (s *csrfState) verify(submitted string) bool {
+	stored := s.stored()
+	token := unmaskCSRFToken(submitted)
+	return stored != nil && token != nil && subtle.ConstantTimeCompare(stored, token) == 1
+}
+
+// submittedToken gets the token from the header, or the form field of a url-encoded body
+func (cfg *CSRFConfig) submittedToken(ctx *Context) string {
+	if token := ctx.Req.Header.Get(cfg.HeaderName); token != "" {
+		return token
+	}
+	// Parsing a multipart body here would read it before UploadLimit of the route
+	if strings.HasPrefix(ctx.Req.Header.Get("Content-Type"), "multipart/form-data") {
+		return ""
+	}
+	// Parse the body, a token in the URL query is not accepted as it leaks by logs and Referer
+	if _, err := ctx.FormValue(cfg.FieldName); err != nil {
+		return ""
+	}
+	return ctx.Req.PostForm.Get(cfg.FieldName)
+}
+
+// sameOrigin checks Sec-Fetch-Site sent by modern browsers, or Origin by older ones.
+// A request with neither is not from a browser, so it is not a CSRF.
+func (cfg *CSRFConfig) sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	for _, trusted := range cfg.TrustedOrigins {
+		if origin != "" && strings.EqualFold(trusted, origin) {
+			return true
+		}
+	}
+	switch req.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		// "none" is typed by the user, e.g. a bookmark
+		return true
+	case "":
+	default:
+		return false
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// maskCSRFToken encodes a random pad followed by token XOR pad
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	if _, err := rand.Read(masked[:len(token)]); err != nil {
+		return ""
+	}
+	for i, b := range token {
+		masked[len(token)+i] = b ^ masked[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken reverts maskCSRFToken, nil if malformed
+func unmaskCSRFToken(masked string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil || len(decoded) != 2*csrfTokenLen {
+		return nil
+	}
+	token := make([]byte, csrfTokenLen)
+	for i := range token {
+		token[i] = decoded[i] ^ decoded[csrfTokenLen+i]
+	}
+	return token
+}
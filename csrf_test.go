@@ -0,0 +1,159 @@
+package web
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newCSRFServer makes a server with a form page and its submit route
+func newCSRFServer(mdls ...Middleware) *HTTPServer {
+	h := NewHTTPServer(ServerWithMiddleware(mdls...))
+	h.Get("/form", func(ctx *Context) {
+		ctx.Resp.Write([]byte(ctx.CSRFToken()))
+	})
+	h.Post("/form", func(ctx *Context) {
+		ctx.Resp.Write([]byte("saved"))
+	})
+	return h
+}
+
+// Test: tokens by form field or header, with double-submit cookie or session
+func TestCSRF(t *testing.T) {
+	servers := map[string]*HTTPServer{
+		"double-submit": newCSRFServer(CSRF(CSRFConfig{TrustedOrigins: []string{"https://admin.example.com"}})),
+		"session": newCSRFServer(Sessions(SessionConfig{Store: NewMemoryStore()}),
+			CSRF(CSRFConfig{UseSession: true, TrustedOrigins: []string{"https://admin.example.com"}})),
+	}
+	for name, h := range servers {
+		t.Run(name, func(t *testing.T) {
+			// get the form, the token is kept by the cookie or the session
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+			token := recorder.Body.String()
+			require.NotEmpty(t, token)
+			cookies := recorder.Result().Cookies()
+			require.Len(t, cookies, 1)
+
+			// masked differently every time
+			recorder = httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/form", nil)
+			req.AddCookie(cookies[0])
+			h.ServeHTTP(recorder, req)
+			anotherToken := recorder.Body.String()
+			assert.NotEqual(t, token, anotherToken)
+
+			testCases := []struct {
+				caseName string
+				form     url.Values
+				header   http.Header
+				wantCode int
+			}{
+				{caseName: "Form field", form: url.Values{"csrf_token": {token}}, wantCode: http.StatusOK},
+				{caseName: "Another mask", form: url.Values{"csrf_token": {anotherToken}}, wantCode: http.StatusOK},
+				{caseName: "Header", header: http.Header{"X-Csrf-Token": {token}}, wantCode: http.StatusOK},
+				{caseName: "Same origin", form: url.Values{"csrf_token": {token}},
+					header: http.Header{"Origin": {"http://example.com"}, "Sec-Fetch-Site": {"same-origin"}}, wantCode: http.StatusOK},
+				{caseName: "Trusted origin", form: url.Values{"csrf_token": {token}},
+					header: http.Header{"Origin": {"https://admin.example.com"}, "Sec-Fetch-Site": {"same-site"}}, wantCode: http.StatusOK},
+				{caseName: "No token", wantCode: http.StatusForbidden},
+				{caseName: "Wrong token", form: url.Values{"csrf_token": {strings.Repeat("A", 86)}}, wantCode: http.StatusForbidden},
+				{caseName: "Malformed token", form: url.Values{"csrf_token": {"abc"}}, wantCode: http.StatusForbidden},
+				{caseName: "Cross site", form: url.Values{"csrf_token": {token}},
+					header: http.Header{"Sec-Fetch-Site": {"cross-site"}}, wantCode: http.StatusForbidden},
+				{caseName: "Other origin", form: url.Values{"csrf_token": {token}},
+					header: http.Header{"Origin": {"https://evil.com"}}, wantCode: http.StatusForbidden},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.caseName, func(t *testing.T) {
+					req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(tc.form.Encode()))
+					req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+					for key, values := range tc.header {
+						req.Header[key] = values
+					}
+					req.AddCookie(cookies[0])
+					recorder := httptest.NewRecorder()
+					h.ServeHTTP(recorder, req)
+					assert.Equal(t, tc.wantCode, recorder.Code)
+				})
+			}
+
+			// the token does not work without the cookie
+			req = httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-CSRF-Token", token)
+			recorder = httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusForbidden, recorder.Code)
+		})
+	}
+}
+
+// Test: multipart bodies are left to the upload limits of the route, the token goes by the header
+func TestCSRF_Upload(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(CSRF(CSRFConfig{})))
+	h.Get("/upload", func(ctx *Context) {
+		ctx.Resp.Write([]byte(ctx.CSRFToken()))
+	})
+	h.Post("/upload", UploadLimit(UploadLimits{AllowedTypes: []string{"image/*"}})(func(ctx *Context) {
+		fh, err := ctx.FormFile("file")
+		if err != nil {
+			http.Error(ctx.Resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx.Resp.Write([]byte(fh.Filename))
+	}))
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/upload", nil))
+	token := recorder.Body.String()
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	testCases := []struct {
+		caseName   string
+		file       uploadFile
+		token      string
+		fieldToken string
+		wantCode   int
+		wantBody   string
+	}{
+		{caseName: "Allowed", file: uploadFile{field: "file", filename: "a.png", content: pngHead}, token: token,
+			wantCode: http.StatusOK, wantBody: "a.png"},
+		{caseName: "Type not allowed", file: uploadFile{field: "file", filename: "a.png", content: []byte("<html>")},
+			token: token, wantCode: http.StatusBadRequest, wantBody: "file type not allowed: text/html\n"},
+		// parsing the body for the field would skip the limits
+		{caseName: "Form field", file: uploadFile{field: "file", filename: "a.png", content: []byte("<html>")},
+			fieldToken: token, wantCode: http.StatusForbidden, wantBody: "Forbidden - invalid CSRF token\n"},
+		{caseName: "No token", file: uploadFile{field: "file", filename: "a.png", content: pngHead},
+			wantCode: http.StatusForbidden, wantBody: "Forbidden - invalid CSRF token\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			var body bytes.Buffer
+			w := multipart.NewWriter(&body)
+			if tc.fieldToken != "" {
+				require.NoError(t, w.WriteField("csrf_token", tc.fieldToken))
+			}
+			fw, err := w.CreateFormFile(tc.file.field, tc.file.filename)
+			require.NoError(t, err)
+			fw.Write(tc.file.content)
+			require.NoError(t, w.Close())
+			req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+			if tc.token != "" {
+				req.Header.Set("X-CSRF-Token", tc.token)
+			}
+			req.AddCookie(cookies[0])
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
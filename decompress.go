@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Decoder decompresses r, it is registered by the Content-Encoding name, see DecompressConfig
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// DecompressConfig configures the request decompression middleware
+type DecompressConfig struct {
+	// MaxBytes is the limit of the decompressed body, so that a small zip bomb cannot exhaust the server.
+	// Default is 10 MB.
+	MaxBytes int64
+	// Decoders add encodings, or replace gzip and deflate, by the Content-Encoding name
+	Decoders map[string]Decoder
+}
+
+// Decompress is the request decompression middleware. A body of Content-Encoding gzip or deflate is decompressed
+// transparently for BindJSON, FormValue and the others, with Content-Encoding and Content-Length removed.
+// A body decompressing beyond MaxBytes fails with *BodyTooLargeError, a corrupt one with a 400 *HTTPError,
+// both can be responded by Context.Error. Unsupported encodings get 415 with the supported ones in
+// Accept-Encoding.
+// A BodyLimit before it limits the compressed body, a BodyLimit after it the decompressed one.
+func Decompress(cfg DecompressConfig) Middleware {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 10 << 20
+	}
+	decoders := map[string]Decoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": newDeflateReader,
+	}
+	for name, decoder := range cfg.Decoders {
+		decoders[strings.ToLower(name)] = decoder
+	}
+	decoders["x-gzip"] = decoders["gzip"]
+	supported := make([]string, 0, len(decoders))
+	for name := range decoders {
+		if name != "x-gzip" {
+			supported = append(supported, name)
+		}
+	}
+	sort.Strings(supported)
+	acceptEncoding := strings.Join(supported, ", ")
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			contentEncoding := ctx.Req.Header.Get("Content-Encoding")
+			if contentEncoding == "" || ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+				next(ctx)
+				return
+			}
+
+			// Listed in the order applied, so decoded from the last
+			var chain []Decoder
+			for _, name := range strings.Split(contentEncoding, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "" || name == "identity" {
+					continue
+				}
+				decoder, ok := decoders[name]
+				if !ok {
+					ctx.Resp.Header().Set("Accept-Encoding", acceptEncoding)
+					ctx.Error(NewHTTPError(http.StatusUnsupportedMediaType, ""))
+					return
+				}
+				chain = append(chain, decoder)
+			}
+
+			body := &decompressedBody{src: ctx.Req.Body, chain: chain}
+			ctx.Req.Body = &limitedBody{
+				ReadCloser: http.MaxBytesReader(ctx.Resp, body, cfg.MaxBytes),
+				limit:      cfg.MaxBytes,
+				declared:   -1,
+			}
+			// an inner BodyLimit limits the decompressed body
+			ctx.rawBody = ctx.Req.Body
+			ctx.Req.Header.Del("Content-Encoding")
+			ctx.Req.Header.Del("Content-Length")
+			ctx.Req.ContentLength = -1
+			next(ctx)
+		}
+	}
+}
+
+// decompressedBody sets the decoders up at the first read, so that a corrupt header fails the read of the handler
+type decompressedBody struct {
+	src     io.ReadCloser
+	chain   []Decoder
+	r       io.Reader
+	closers []io.Closer
+	err     error
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r = b.src
+		for i := len(b.chain) - 1; i >= 0; i-- {
+			rc, err := b.chain[i](b.r)
+			if err != nil {
+				b.err = decodeError(err)
+				break
+			}
+			b.closers = append(b.closers, rc)
+			b.r = rc
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = decodeError(err)
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		b.closers[i].Close()
+	}
+	return b.src.Close()
+}
+
+// decodeError makes the errors of decoding 400, the limit of an outer BodyLimit is kept
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return &HTTPError{Code: http.StatusBadRequest, Err: err}
+}
+
+// newDeflateReader reads "deflate" of HTTP, which is the zlib format. Some clients send raw deflate instead,
+// it is read as such if the zlib header is missing.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// RFC 1950: the method is 8 (deflate), and the two bytes are a multiple of 31
+	if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,101 @@
+package web
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test: compressed bodies are bound, bombs, corrupt bodies and unknown encodings are refused
+func TestDecompress(t *testing.T) {
+	gzipped := func(s string) string {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.String()
+	}
+	zlibbed := func(s string) string {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.String()
+	}
+	// raw deflate sent by some clients
+	deflated := func(s string) string {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.String()
+	}
+	bomb := gzipped(`{"a":"` + strings.Repeat("0", 1<<20) + `"}`)
+
+	h := NewHTTPServer(ServerWithMiddleware(Decompress(DecompressConfig{MaxBytes: 1024})))
+	bind := func(ctx *Context) {
+		var val map[string]string
+		if err := ctx.BindJSON(&val); err != nil {
+			ctx.Error(err)
+			return
+		}
+		ctx.Resp.Header().Set("X-Content-Encoding", ctx.Req.Header.Get("Content-Encoding"))
+		ctx.Resp.Write([]byte(val["a"]))
+	}
+	h.Post("/json", bind)
+	// a BodyLimit after Decompress limits the decompressed body
+	h.Group("/limited", BodyLimit(16)).Post("/", bind)
+
+	testCases := []struct {
+		caseName        string
+		path            string
+		contentEncoding string
+		body            string
+		wantCode        int
+		wantBody        string
+		wantHeader      http.Header
+	}{
+		{caseName: "Plain", path: "/json", body: `{"a":"b"}`, wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Gzip", path: "/json", contentEncoding: "gzip", body: gzipped(`{"a":"b"}`),
+			wantCode: http.StatusOK, wantBody: "b", wantHeader: http.Header{"X-Content-Encoding": {""}}},
+		{caseName: "Deflate", path: "/json", contentEncoding: "Deflate", body: zlibbed(`{"a":"b"}`),
+			wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Raw deflate", path: "/json", contentEncoding: "deflate", body: deflated(`{"a":"b"}`),
+			wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Applied twice", path: "/json", contentEncoding: "deflate, gzip", body: gzipped(zlibbed(`{"a":"b"}`)),
+			wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Identity", path: "/json", contentEncoding: "identity", body: `{"a":"b"}`,
+			wantCode: http.StatusOK, wantBody: "b"},
+		{caseName: "Bomb", path: "/json", contentEncoding: "gzip", body: bomb,
+			wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+		{caseName: "Corrupt", path: "/json", contentEncoding: "gzip", body: `{"a":"b"}`,
+			wantCode: http.StatusBadRequest, wantBody: "Bad Request\n"},
+		{caseName: "Unsupported", path: "/json", contentEncoding: "br", body: `{"a":"b"}`,
+			wantCode: http.StatusUnsupportedMediaType, wantBody: "Unsupported Media Type\n",
+			wantHeader: http.Header{"Accept-Encoding": {"deflate, gzip"}}},
+		{caseName: "Decompressed over group limit", path: "/limited", contentEncoding: "gzip",
+			body:     gzipped(`{"a":"` + strings.Repeat("0", 100) + `"}`),
+			wantCode: http.StatusRequestEntityTooLarge, wantBody: "Request Entity Too Large\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tc.contentEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			for key, values := range tc.wantHeader {
+				assert.Equal(t, values, recorder.Header()[key])
+			}
+		})
+	}
+}
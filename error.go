@@ -0,0 +1,74 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPError is an error responded with a status code, see Context.Error
+type HTTPError struct {
+	Code int
+	// Message is sent to the client, the status text by default
+	Message string
+	// Err is the cause, it is not sent to the client
+	Err error
+}
+
+// NewHTTPError constructs an HTTPError, message is the status text if empty
+func NewHTTPError(code int, message string) *HTTPError {
+	return &HTTPError{Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Code)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler responds an error
+type ErrorHandler func(ctx *Context, err error)
+
+// ServerWithErrorHandler sets the handler responding the errors of Context.Error, e.g. to respond JSON.
+// Default is DefaultErrorHandler.
+func ServerWithErrorHandler(handler ErrorHandler) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.errorHandler = handler
+	}
+}
+
+// DefaultErrorHandler responds the code and message of an *HTTPError in plain text,
+// *BodyTooLargeError gets 413, other errors get 500 without details
+func DefaultErrorHandler(ctx *Context, err error) {
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		err = &HTTPError{Code: http.StatusRequestEntityTooLarge, Err: err}
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		http.Error(ctx.Resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	msg := httpErr.Message
+	if msg == "" {
+		msg = http.StatusText(httpErr.Code)
+	}
+	http.Error(ctx.Resp, msg, httpErr.Code)
+}
+
+// Error responds err by the error handler of the server. Headers set before, e.g. Retry-After, are kept.
+func (c *Context) Error(err error) {
+	if c.server != nil && c.server.errorHandler != nil {
+		c.server.errorHandler(c, err)
+		return
+	}
+	DefaultErrorHandler(c, err)
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: errors responded by the default error handler
+func TestContext_Error(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{caseName: "Status text", err: NewHTTPError(http.StatusTooManyRequests, ""),
+			wantCode: http.StatusTooManyRequests, wantBody: "Too Many Requests\n"},
+		{caseName: "Message", err: NewHTTPError(http.StatusBadRequest, "bad name"),
+			wantCode: http.StatusBadRequest, wantBody: "bad name\n"},
+		{caseName: "Cause is hidden", err: &HTTPError{Code: http.StatusServiceUnavailable, Err: errors.New("db is down")},
+			wantCode: http.StatusServiceUnavailable, wantBody: "Service Unavailable\n"},
+		{caseName: "Other errors", err: errors.New("db is down"),
+			wantCode: http.StatusInternalServerError, wantBody: "Internal Server Error\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			h := NewHTTPServer()
+			h.Get("/", func(ctx *Context) {
+				ctx.Error(tc.err)
+			})
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagConfig configures the ETag middleware
+type ETagConfig struct {
+	// Weak makes the generated ETags weak, for responses which are equivalent but not byte for byte the same,
+	// e.g. compressed by another middleware
+	Weak bool
+}
+
+// ETag is the ETag and conditional request middleware. The successful responses of GET and HEAD get an ETag
+// from the hash of their body, unless the handler sets one, and 304 if If-None-Match or If-Modified-Since tell
+// the client has it already, or 412 if If-Match or If-Unmodified-Since fail.
+// The body is buffered to compute the ETag, a response flushed without one is streamed as is.
+// A handler knowing the ETag or Last-Modified up front should set them and call Context.CheckPreconditions
+// before doing the work, which is also how the preconditions of other methods are checked.
+func ETag(cfg ETagConfig) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.Method != http.MethodGet && ctx.Req.Method != http.MethodHead {
+				next(ctx)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: ctx.Resp, ctx: ctx, weak: cfg.Weak}
+			ctx.Resp = ew
+			defer func() {
+				ctx.Resp = ew.ResponseWriter
+				ew.close()
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// SetETag sets the ETag of the response, tag is quoted
+func (c *Context) SetETag(tag string, weak bool) {
+	etag := `"` + tag + `"`
+	if weak {
+		etag = "W/" + etag
+	}
+	c.Resp.Header().Set("ETag", etag)
+}
+
+// SetLastModified sets the Last-Modified of the response
+func (c *Context) SetLastModified(t time.Time) {
+	c.Resp.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match and If-Modified-Since against the
+// ETag and Last-Modified set on the response. If they fail, it responds 304, or 412 by the error handler, and
+// reports false, the handler should return then.
+//
+//	ctx.SetETag(article.Version, false)
+//	ctx.SetLastModified(article.UpdatedAt)
+//	if !ctx.CheckPreconditions() {
+//		return
+//	}
+//	// render or update the article
+func (c *Context) CheckPreconditions() bool {
+	switch code := evaluatePreconditions(c.Req, c.Resp.Header()); code {
+	case http.StatusNotModified:
+		writeNotModified(c.Resp)
+		return false
+	case http.StatusPreconditionFailed:
+		c.Error(NewHTTPError(code, ""))
+		return false
+	}
+	return true
+}
+
+// evaluatePreconditions returns 304, 412 or 0 if the request goes on, in the order of RFC 9110 section 13.2.2
+func evaluatePreconditions(req *http.Request, header http.Header) int {
+	etag := header.Get("ETag")
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	hasLastModified := err == nil
+	safe := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Unmodified-Since")); err == nil && hasLastModified {
+		if lastModified.Truncate(time.Second).After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, false) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && hasLastModified && safe {
+		if !lastModified.Truncate(time.Second).After(since) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// etagListMatches reports whether etag is in the list of a conditional header, "*" matches any etag.
+// The strong comparison does not match weak ETags.
+func etagListMatches(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return etag != ""
+	}
+	if etag == "" || strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	opaque := strings.TrimPrefix(etag, "W/")
+	for list != "" {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			break
+		}
+		weak := strings.HasPrefix(list, "W/")
+		list = strings.TrimPrefix(list, "W/")
+		if !strings.HasPrefix(list, `"`) {
+			return false
+		}
+		end := strings.IndexByte(list[1:], '"')
+		if end < 0 {
+			return false
+		}
+		tag := list[:end+2]
+		list = list[end+2:]
+		if tag == opaque && !(strong && weak) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified responds 304 with the validators, without the headers of the body
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if header.Get("ETag") != "" {
+		header.Del("Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// etagWriter buffers a successful response to compute its ETag. The response is sent as is, unbuffered, if it
+// is not 200, if the handler sets the ETag or flushes.
+type etagWriter struct {
+	http.ResponseWriter
+	ctx         *Context
+	weak        bool
+	code        int
+	wroteHeader bool
+	passThrough bool
+	discard     bool // 304 or 412 is responded instead
+	buf         bytes.Buffer
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	// informational responses go at once
+	if code < http.StatusOK {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	ew.wroteHeader, ew.code = true, code
+	if code != http.StatusOK {
+		ew.passThrough = true
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if ew.Header().Get("ETag") != "" {
+		// known already, no need to buffer
+		ew.passThrough = true
+		ew.respond()
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.discard {
+		return len(b), nil
+	}
+	if ew.passThrough {
+		return ew.ResponseWriter.Write(b)
+	}
+	return ew.buf.Write(b)
+}
+
+// Flush sends the response without an ETag, so that streaming responses are not held back
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if !ew.passThrough {
+		ew.passThrough = true
+		ew.respond()
+		if !ew.discard {
+			ew.ResponseWriter.Write(ew.buf.Bytes())
+		}
+		ew.buf.Reset()
+	}
+	if ew.discard {
+		return
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// close computes the ETag of the buffered body and sends the response
+func (ew *etagWriter) close() {
+	if !ew.wroteHeader || ew.passThrough {
+		return
+	}
+	// net/http drops the body of HEAD, an empty one is not the one of GET
+	if ew.buf.Len() > 0 || ew.ctx.Req.Method == http.MethodGet {
+		sum := sha256.Sum256(ew.buf.Bytes())
+		ew.ctx.SetETag(base64.RawURLEncoding.EncodeToString(sum[:18]), ew.weak)
+	}
+	ew.respond()
+	if !ew.discard {
+		ew.ResponseWriter.Write(ew.buf.Bytes())
+	}
+	ew.buf.Reset()
+}
+
+// respond writes the header of the 200 response, or responds 304 or 412 if the preconditions fail
+func (ew *etagWriter) respond() {
+	switch code := evaluatePreconditions(ew.ctx.Req, ew.Header()); code {
+	case http.StatusNotModified:
+		ew.discard = true
+		writeNotModified(ew.ResponseWriter)
+	case http.StatusPreconditionFailed:
+		ew.discard = true
+		errCtx := *ew.ctx
+		errCtx.Resp = ew.ResponseWriter
+		errCtx.Error(NewHTTPError(code, ""))
+	default:
+		ew.ResponseWriter.WriteHeader(ew.code)
+	}
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test: generated and known ETags, revalidated by the conditional headers
+func TestETag(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	worked := 0
+	h := NewHTTPServer(ServerWithMiddleware(ETag(ETagConfig{})))
+	h.Get("/report", func(ctx *Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		ctx.Resp.Write([]byte("report"))
+	})
+	h.Get("/article", func(ctx *Context) {
+		ctx.SetETag("v2", false)
+		ctx.SetLastModified(modified)
+		if !ctx.CheckPreconditions() {
+			return
+		}
+		worked++
+		ctx.Resp.Write([]byte("article"))
+	})
+	h.AddRoute(http.MethodPut, "/article", func(ctx *Context) {
+		ctx.SetETag("v2", false)
+		if !ctx.CheckPreconditions() {
+			return
+		}
+		worked++
+		ctx.Resp.Write([]byte("updated"))
+	})
+	h.Get("/missing", func(ctx *Context) {
+		ctx.Error(NewHTTPError(http.StatusNotFound, ""))
+	})
+
+	// the generated ETag is stable
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report", nil))
+	reportETag := recorder.Header().Get("ETag")
+	require.NotEmpty(t, reportETag)
+	assert.Equal(t, "report", recorder.Body.String())
+
+	testCases := []struct {
+		caseName   string
+		method     string
+		path       string
+		header     http.Header
+		wantCode   int
+		wantBody   string
+		wantETag   string
+		wantWorked int
+	}{
+		{caseName: "Generated match", method: http.MethodGet, path: "/report",
+			header: http.Header{"If-None-Match": {`"other", ` + reportETag}}, wantCode: http.StatusNotModified,
+			wantETag: reportETag},
+		{caseName: "Generated mismatch", method: http.MethodGet, path: "/report",
+			header: http.Header{"If-None-Match": {`"other"`}}, wantCode: http.StatusOK, wantBody: "report",
+			wantETag: reportETag},
+		{caseName: "Weak match", method: http.MethodGet, path: "/article",
+			header: http.Header{"If-None-Match": {`W/"v2"`}}, wantCode: http.StatusNotModified, wantETag: `"v2"`},
+		{caseName: "Not modified since", method: http.MethodGet, path: "/article",
+			header:   http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}},
+			wantCode: http.StatusNotModified, wantETag: `"v2"`},
+		{caseName: "Modified since", method: http.MethodGet, path: "/article",
+			header:   http.Header{"If-Modified-Since": {modified.Add(-time.Hour).Format(http.TimeFormat)}},
+			wantCode: http.StatusOK, wantBody: "article", wantETag: `"v2"`, wantWorked: 1},
+		{caseName: "If-None-Match wins", method: http.MethodGet, path: "/article",
+			header:   http.Header{"If-None-Match": {`"v1"`}, "If-Modified-Since": {modified.Format(http.TimeFormat)}},
+			wantCode: http.StatusOK, wantBody: "article", wantETag: `"v2"`, wantWorked: 1},
+		{caseName: "Update matching", method: http.MethodPut, path: "/article",
+			header: http.Header{"If-Match": {`"v2"`}}, wantCode: http.StatusOK, wantBody: "updated", wantETag: `"v2"`,
+			wantWorked: 1},
+		{caseName: "Lost update", method: http.MethodPut, path: "/article",
+			header: http.Header{"If-Match": {`"v1"`}}, wantCode: http.StatusPreconditionFailed,
+			wantBody: "Precondition Failed\n", wantETag: `"v2"`},
+		{caseName: "Weak If-Match", method: http.MethodPut, path: "/article",
+			header: http.Header{"If-Match": {`W/"v2"`}}, wantCode: http.StatusPreconditionFailed,
+			wantBody: "Precondition Failed\n", wantETag: `"v2"`},
+		{caseName: "Create only", method: http.MethodPut, path: "/article",
+			header: http.Header{"If-None-Match": {"*"}}, wantCode: http.StatusPreconditionFailed,
+			wantBody: "Precondition Failed\n", wantETag: `"v2"`},
+		{caseName: "Unmodified since fails", method: http.MethodGet, path: "/article",
+			header:   http.Header{"If-Unmodified-Since": {modified.Add(-time.Hour).Format(http.TimeFormat)}},
+			wantCode: http.StatusPreconditionFailed, wantBody: "Precondition Failed\n", wantETag: `"v2"`},
+		{caseName: "Errors untouched", method: http.MethodGet, path: "/missing",
+			header: http.Header{"If-None-Match": {"*"}}, wantCode: http.StatusNotFound, wantBody: "Not Found\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			worked = 0
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for key, values := range tc.header {
+				req.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantETag, recorder.Header().Get("ETag"))
+			assert.Equal(t, tc.wantWorked, worked)
+			if tc.wantCode == http.StatusNotModified {
+				assert.Empty(t, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// Test: weak ETags by config, and flushed responses are streamed without one
+func TestETag_WeakAndStreaming(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(ETag(ETagConfig{Weak: true})))
+	h.Get("/", func(ctx *Context) {
+		ctx.Resp.Write([]byte("page"))
+	})
+	h.Get("/stream", func(ctx *Context) {
+		ctx.Resp.Write([]byte("part 1;"))
+		http.NewResponseController(ctx.Resp).Flush()
+		ctx.Resp.Write([]byte("part 2;"))
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := recorder.Header().Get("ETag")
+	assert.Regexp(t, `^W/".+"$`, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.True(t, recorder.Flushed)
+	assert.Empty(t, recorder.Header().Get("ETag"))
+	assert.Equal(t, "part 1;part 2;", recorder.Body.String())
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File responds the file at path on disk. Range, If-Range and the conditional headers are handled.
+func (c *Context) File(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		fsError(c, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fsError(c, err)
+		return
+	}
+	if info.IsDir() {
+		http.NotFound(c.Resp, c.Req)
+		return
+	}
+	http.ServeContent(c.Resp, c.Req, info.Name(), info.ModTime(), f)
+}
+
+// Attachment responds content as a file to download named filename, modTime can be zero if unknown.
+// If content is an io.ReadSeeker, e.g. *os.File or *bytes.Reader, Range and If-Range are handled so that
+// clients can resume downloads. Otherwise, content is copied as a whole.
+func (c *Context) Attachment(content io.Reader, filename string, modTime time.Time) {
+	c.Resp.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	if rs, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(c.Resp, c.Req, filename, modTime, rs)
+		return
+	}
+
+	header := c.Resp.Header()
+	if header.Get("Content-Type") == "" {
+		// Sniff the type like http.ServeContent does, without losing the head
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(content, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			http.Error(c.Resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		header.Set("Content-Type", http.DetectContentType(head[:n]))
+		content = io.MultiReader(bytes.NewReader(head[:n]), content)
+	}
+	if !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	c.Resp.WriteHeader(http.StatusOK)
+	if c.Req.Method != http.MethodHead {
+		io.Copy(c.Resp, content)
+	}
+}
+
+// Stream responds chunks written by step until it returns false or the client is gone, flushing each chunk.
+// It reports whether the client is gone before step finishes.
+func (c *Context) Stream(contentType string, step func(w io.Writer) bool) bool {
+	c.Resp.Header().Set("Content-Type", contentType)
+	// Without Content-Length, the response is chunked
+	c.Resp.Header().Del("Content-Length")
+	rc := http.NewResponseController(c.Resp)
+	done := c.Req.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+		}
+		keepOn := step(c.Resp)
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return true
+		}
+		if !keepOn {
+			return false
+		}
+	}
+}
+
+// contentDisposition makes a Content-Disposition header of RFC 6266. A non-ASCII filename is put in
+// "filename*" encoded as UTF-8, along with an ASCII fallback in "filename" for old clients.
+func contentDisposition(dispositionType, filename string) string {
+	filename = filepath.Base(filename)
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range filename {
+		switch {
+		case r >= 0x80:
+			ascii = false
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			// quotes and control characters are not welcome in the quoted-string
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	res := dispositionType + `; filename="` + fallback.String() + `"`
+	if !ascii || fallback.String() != filename {
+		res += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return res
+}
+
+// encodeRFC5987 percent-encodes s except attr-char of RFC 5987
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[b>>4])
+		sb.WriteByte(hex[b&0x0f])
+	}
+	return sb.String()
+}
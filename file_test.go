@@ -0,0 +1,166 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: respond a file on disk
+func TestContext_File(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o644))
+
+	h := NewHTTPServer()
+	h.Get("/report", func(ctx *Context) {
+		ctx.File(path)
+	})
+	h.Get("/missing", func(ctx *Context) {
+		ctx.File(filepath.Join(dir, "missing.txt"))
+	})
+	h.Get("/dir", func(ctx *Context) {
+		ctx.File(dir)
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "0123456789", recorder.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	req := httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.Header.Set("Range", "bytes=-3")
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "789", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dir", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// Test: respond content to download, resumable if it can seek
+func TestContext_Attachment(t *testing.T) {
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := NewHTTPServer()
+	h.Get("/seeker", func(ctx *Context) {
+		ctx.Attachment(bytes.NewReader([]byte("0123456789")), "报告 2023.csv", modTime)
+	})
+	h.Get("/reader", func(ctx *Context) {
+		ctx.Attachment(io.MultiReader(strings.NewReader("plain reader")), "a.txt", time.Time{})
+	})
+
+	testCases := []struct {
+		caseName        string
+		url             string
+		header          map[string]string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{
+			caseName:        "utf-8 filename",
+			url:             "/seeker",
+			wantCode:        http.StatusOK,
+			wantBody:        "0123456789",
+			wantDisposition: `attachment; filename="__ 2023.csv"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202023.csv`,
+		},
+		{
+			caseName:        "resume by range",
+			url:             "/seeker",
+			header:          map[string]string{"Range": "bytes=5-"},
+			wantCode:        http.StatusPartialContent,
+			wantBody:        "56789",
+			wantDisposition: `attachment; filename="__ 2023.csv"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202023.csv`,
+		},
+		{
+			caseName: "if-range not matched responds the whole",
+			url:      "/seeker",
+			header: map[string]string{
+				"Range":    "bytes=5-",
+				"If-Range": modTime.Add(-time.Hour).Format(http.TimeFormat),
+			},
+			wantCode:        http.StatusOK,
+			wantBody:        "0123456789",
+			wantDisposition: `attachment; filename="__ 2023.csv"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202023.csv`,
+		},
+		{
+			caseName:        "reader cannot seek",
+			url:             "/reader",
+			header:          map[string]string{"Range": "bytes=5-"},
+			wantCode:        http.StatusOK,
+			wantBody:        "plain reader",
+			wantDisposition: `attachment; filename="a.txt"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			for key, value := range tc.header {
+				req.Header.Set(key, value)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantDisposition, recorder.Header().Get("Content-Disposition"))
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert.Equal(t, `attachment; filename="a.txt"`, contentDisposition("attachment", "a.txt"))
+	assert.Equal(t, `inline; filename="a_b_.txt"; filename*=UTF-8''a%22b%5C.txt`, contentDisposition("inline", `a"b\.txt`))
+	// no directories in filename
+	assert.Equal(t, `attachment; filename="passwd"`, contentDisposition("attachment", "/etc/passwd"))
+}
+
+// Test: stream chunks until step returns false or the client is gone
+func TestContext_Stream(t *testing.T) {
+	h := NewHTTPServer()
+	var gone bool
+	h.Get("/stream", func(ctx *Context) {
+		i := 0
+		gone = ctx.Stream("text/plain", func(w io.Writer) bool {
+			i++
+			fmt.Fprintf(w, "chunk %d\n", i)
+			return i < 3
+		})
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.False(t, gone)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "chunk 1\nchunk 2\nchunk 3\n", recorder.Body.String())
+
+	// the client is gone
+	reqCtx, cancel := context.WithCancel(context.Background())
+	h.Get("/endless", func(ctx *Context) {
+		gone = ctx.Stream("text/plain", func(w io.Writer) bool {
+			cancel()
+			w.Write([]byte("x"))
+			return true
+		})
+	})
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/endless", nil).WithContext(reqCtx))
+	assert.True(t, gone)
+	assert.Equal(t, "x", recorder.Body.String())
+}
@@ -0,0 +1,78 @@
+package web
+
+import "net/http"
+
+// Group is a set of routes sharing a path prefix and middlewares, see HTTPServer.Group
+type Group struct {
+	server *HTTPServer
+	parent *Group
+	prefix string
+	mdls   []Middleware
+}
+
+// Group creates a route group under prefix, e.g. "/admin". Unlike the middlewares of the server,
+// the ones of a group run only for the requests matching its routes, after the ones of the server.
+func (h *HTTPServer) Group(prefix string, mdls ...Middleware) *Group {
+	return newGroup(h, nil, prefix, mdls)
+}
+
+// Group creates a sub group, whose middlewares run after the ones of g
+func (g *Group) Group(prefix string, mdls ...Middleware) *Group {
+	return newGroup(g.server, g, g.path(prefix), mdls)
+}
+
+func newGroup(h *HTTPServer, parent *Group, prefix string, mdls []Middleware) *Group {
+	if prefix == "" || prefix[0] != '/' {
+		panic("group prefix should start with /")
+	}
+	if prefix != "/" && prefix[len(prefix)-1] == '/' {
+		panic("group prefix should not end with /")
+	}
+	return &Group{server: h, parent: parent, prefix: prefix, mdls: mdls}
+}
+
+// Use adds middlewares to the group. They apply to the routes added before too.
+func (g *Group) Use(mdls ...Middleware) {
+	g.mdls = append(g.mdls, mdls...)
+}
+
+// AddRoute adds a route of path under the prefix of the group, "/" is the prefix itself
+func (g *Group) AddRoute(method, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	// The body limit is checked inside the middlewares of the group, which may override it
+	g.server.router.AddRoute(method, g.path(path), g.wrap(checkBodyLimit(handleFunc)), opts...)
+}
+
+// Get request tool function
+func (g *Group) Get(path string, handler HandleFunc, opts ...RouteOption) {
+	g.AddRoute(http.MethodGet, path, handler, opts...)
+}
+
+// Post request tool function
+func (g *Group) Post(path string, handler HandleFunc, opts ...RouteOption) {
+	g.AddRoute(http.MethodPost, path, handler, opts...)
+}
+
+// path joins the prefix and p
+func (g *Group) path(p string) string {
+	if p == "/" {
+		return g.prefix
+	}
+	if g.prefix == "/" {
+		return p
+	}
+	return g.prefix + p
+}
+
+// wrap wraps handleFunc with the middlewares of g and its parents.
+// The chain is built per request, so that Use takes effect on the routes added before.
+func (g *Group) wrap(handleFunc HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		root := handleFunc
+		for group := g; group != nil; group = group.parent {
+			for i := len(group.mdls) - 1; i >= 0; i-- {
+				root = group.mdls[i](root)
+			}
+		}
+		root(ctx)
+	}
+}
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: routes of nested groups get the prefixes and the middlewares
+func TestHTTPServer_Group(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				calls = append(calls, name)
+				next(ctx)
+			}
+		}
+	}
+
+	h := NewHTTPServer(ServerWithMiddleware(mark("server")))
+	api := h.Group("/api", mark("api"))
+	api.Get("/", func(ctx *Context) {
+		calls = append(calls, "api index")
+	})
+	admin := api.Group("/admin", mark("admin"))
+	admin.Post("/users/:id", func(ctx *Context) {
+		calls = append(calls, "user "+ctx.PathValue("id"))
+	})
+	// added after the routes
+	admin.Use(mark("audit"))
+	root := h.Group("/")
+	root.Get("/health", func(ctx *Context) {
+		calls = append(calls, "health")
+	})
+
+	testCases := []struct {
+		caseName  string
+		method    string
+		path      string
+		wantCode  int
+		wantCalls []string
+	}{
+		{caseName: "Group index", method: http.MethodGet, path: "/api", wantCode: http.StatusOK,
+			wantCalls: []string{"server", "api", "api index"}},
+		{caseName: "Nested group", method: http.MethodPost, path: "/api/admin/users/42", wantCode: http.StatusOK,
+			wantCalls: []string{"server", "api", "admin", "audit", "user 42"}},
+		{caseName: "Root group", method: http.MethodGet, path: "/health", wantCode: http.StatusOK,
+			wantCalls: []string{"server", "health"}},
+		{caseName: "Not found", method: http.MethodGet, path: "/api/none", wantCode: http.StatusNotFound,
+			wantCalls: []string{"server"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			calls = nil
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantCalls, calls)
+		})
+	}
+
+	assert.Panics(t, func() { h.Group("api") })
+	assert.Panics(t, func() { h.Group("/api/") })
+}
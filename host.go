@@ -0,0 +1,139 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostRoutes is the route table of the hosts matching a pattern
+type HostRoutes struct {
+	*router
+	pattern string
+	labels  []string // pattern split by '.'
+	kind    hostKind
+}
+
+// hostKind is the priority of host patterns, the smaller the higher
+type hostKind int
+
+const (
+	hostExact    hostKind = iota // api.example.com
+	hostParam                    // :tenant.example.com
+	hostWildcard                 // *.example.com
+)
+
+// Host gets the route table of hosts matching pattern. If not exist, create.
+// Pattern can be:
+//   - an exact host: "api.example.com"
+//   - with params, each pairs one label: ":tenant.example.com", values are available by ctx.PathValue
+//   - a wildcard subdomain, pairs one or more labels: "*.example.com"
+//
+// Priority: exact > param > wildcard, hosts of the same kind are tried in the order they are added.
+// Requests of unmatched hosts are routed by the default route table, i.e. HTTPServer.AddRoute.
+func (h *HTTPServer) Host(pattern string) *HostRoutes {
+	pattern = strings.ToLower(pattern)
+	for _, hr := range h.hosts {
+		if hr.pattern == pattern {
+			return hr
+		}
+	}
+
+	labels := strings.Split(pattern, ".")
+	kind := hostExact
+	for idx, label := range labels {
+		switch {
+		case label == "":
+			panic("empty label in host pattern")
+		case label == "*":
+			if idx != 0 {
+				panic("wildcard is only allowed as the first label of host pattern")
+			}
+			kind = hostWildcard
+		case label[0] == ':':
+			if len(label) == 1 {
+				panic("empty param name in host pattern")
+			}
+			if kind == hostExact {
+				kind = hostParam
+			}
+		}
+	}
+
+	r := newRouter()
+	r.useRawPath = h.router.useRawPath
+	hr := &HostRoutes{router: r, pattern: pattern, labels: labels, kind: kind}
+	h.hosts = append(h.hosts, hr)
+	return hr
+}
+
+// AddRoute adds a route, see router.AddRoute. The handler is not run if the body is over BodyLimit.
+func (hr *HostRoutes) AddRoute(method string, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	hr.router.AddRoute(method, path, checkBodyLimit(handleFunc), opts...)
+}
+
+// Get request tool function
+func (hr *HostRoutes) Get(path string, handler HandleFunc, opts ...RouteOption) {
+	hr.AddRoute(http.MethodGet, path, handler, opts...)
+}
+
+// Post request tool function
+func (hr *HostRoutes) Post(path string, handler HandleFunc, opts ...RouteOption) {
+	hr.AddRoute(http.MethodPost, path, handler, opts...)
+}
+
+// findHost finds the route table of host, and the host params.
+// It returns the default route table if no host pattern matches.
+func (h *HTTPServer) findHost(host string) (*router, param) {
+	if len(h.hosts) == 0 {
+		return h.router, nil
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	labels := strings.Split(host, ".")
+
+	for kind := hostExact; kind <= hostWildcard; kind++ {
+		for _, hr := range h.hosts {
+			if hr.kind != kind {
+				continue
+			}
+			if params, ok := hr.match(labels); ok {
+				return hr.router, params
+			}
+		}
+	}
+	return h.router, nil
+}
+
+// match matches the labels of a host against the pattern
+func (hr *HostRoutes) match(labels []string) (param, bool) {
+	patternLabels := hr.labels
+	if hr.kind == hostWildcard {
+		// "*" pairs one or more leading labels
+		patternLabels = patternLabels[1:]
+		if len(labels) <= len(patternLabels) {
+			return nil, false
+		}
+		labels = labels[len(labels)-len(patternLabels):]
+	}
+	if len(labels) != len(patternLabels) {
+		return nil, false
+	}
+
+	var params param
+	for idx, label := range patternLabels {
+		if label[0] == ':' {
+			if params == nil {
+				params = make(param)
+			}
+			params[label[1:]] = labels[idx]
+			continue
+		}
+		if label != labels[idx] {
+			return nil, false
+		}
+	}
+	return params, true
+}
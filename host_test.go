@@ -0,0 +1,113 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: route by host, fall back to the default route table
+func TestHTTPServer_Host(t *testing.T) {
+	h := NewHTTPServer()
+	reply := func(name string) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Resp.Write([]byte(name + " " + ctx.PathValue("tenant") + ctx.PathValue("id")))
+		}
+	}
+	h.Get("/", reply("default"))
+	h.Host("api.example.com").Get("/", reply("api"))
+	h.Host("*.example.com").Get("/", reply("wildcard"))
+	h.Host(":tenant.example.com").Get("/", reply("tenant"))
+	h.Host(":tenant.example.com").Get("/users/:id", reply("tenant user"))
+	h.Host("Admin.Example.com").Get("/", reply("admin"))
+
+	testCases := []struct {
+		caseName string
+		host     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseName: "exact host",
+			host:     "api.example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "api ",
+		},
+		{
+			caseName: "exact host is case-insensitive and ignores port",
+			host:     "ADMIN.example.com:8080",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "admin ",
+		},
+		{
+			caseName: "host param",
+			host:     "acme.example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "tenant acme",
+		},
+		{
+			caseName: "host param with path param",
+			host:     "acme.example.com",
+			path:     "/users/42",
+			wantCode: http.StatusOK,
+			wantBody: "tenant user acme42",
+		},
+		{
+			caseName: "wildcard subdomain pairs more labels",
+			host:     "a.b.example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "wildcard ",
+		},
+		{
+			caseName: "host route table does not fall back",
+			host:     "api.example.com",
+			path:     "/users/42",
+			wantCode: http.StatusNotFound,
+			wantBody: "404 page not found\n",
+		},
+		{
+			caseName: "unmatched host falls back to default",
+			host:     "example.org",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "default ",
+		},
+		{
+			caseName: "wildcard does not pair the bare domain",
+			host:     "example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "default ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Host = tc.host
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPServer_HostIncorrect(t *testing.T) {
+	h := NewHTTPServer()
+	assert.Panicsf(t, func() {
+		h.Host("api..example.com")
+	}, "Empty label")
+	assert.Panicsf(t, func() {
+		h.Host("api.*.com")
+	}, "Wildcard not the first label")
+	assert.Panicsf(t, func() {
+		h.Host(":.example.com")
+	}, "Empty param name")
+}
@@ -0,0 +1,233 @@
+package web
+
+import "sync"
+
+// defaultHubBufferSize is how many messages can be queued for a connection before it is evicted
+const defaultHubBufferSize = 16
+
+// PresenceFunc is called when a connection joins or leaves a room
+type PresenceFunc func(room string, ctx *Context, conn *WebSocketConn)
+
+// Hub groups WebSocket connections into named rooms and broadcasts messages to them.
+// Every connection has a send buffer written by its own goroutine, so that a slow client does not hold back
+// the others. A connection whose buffer is full is evicted: it leaves all rooms and is closed with
+// ClosePolicyViolation.
+type Hub struct {
+	mu         sync.RWMutex
+	rooms      map[string]map[*hubClient]struct{}
+	clients    map[*WebSocketConn]*hubClient
+	bufferSize int
+	onJoin     PresenceFunc
+	onLeave    PresenceFunc
+}
+
+// HubOption configures a Hub
+type HubOption func(h *Hub)
+
+// HubWithBufferSize sets the send buffer size of each connection. Default is 16 messages.
+func HubWithBufferSize(n int) HubOption {
+	return func(h *Hub) {
+		h.bufferSize = n
+	}
+}
+
+// HubWithOnJoin calls fn after a connection joins a room
+func HubWithOnJoin(fn PresenceFunc) HubOption {
+	return func(h *Hub) {
+		h.onJoin = fn
+	}
+}
+
+// HubWithOnLeave calls fn after a connection leaves a room, including when it is closed or evicted
+func HubWithOnLeave(fn PresenceFunc) HubOption {
+	return func(h *Hub) {
+		h.onLeave = fn
+	}
+}
+
+// NewHub constructs a Hub
+func NewHub(opts ...HubOption) *Hub {
+	h := &Hub{
+		rooms:      make(map[string]map[*hubClient]struct{}),
+		clients:    make(map[*WebSocketConn]*hubClient),
+		bufferSize: defaultHubBufferSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+type hubClient struct {
+	ctx   *Context
+	conn  *WebSocketConn
+	send  chan hubMessage
+	rooms map[string]struct{}
+}
+
+type hubMessage struct {
+	typ  WebSocketMessageType
+	data []byte
+}
+
+// Handle adapts handler to join the room named by the path param, e.g. "id" of "/ws/room/:id",
+// and to leave all rooms when it returns. A nil handler reads and drops messages until the connection is closed.
+//
+//	hub := NewHub()
+//	server.WebSocket("/ws/room/:id", hub.Handle("id", nil))
+//	hub.Broadcast("42", TextMessage, []byte("hello room 42"))
+func (h *Hub) Handle(param string, handler WebSocketHandler) WebSocketHandler {
+	return func(ctx *Context, conn *WebSocketConn) {
+		h.Join(ctx, ctx.PathValue(param), conn)
+		defer h.leaveAll(conn, false)
+		if handler != nil {
+			handler(ctx, conn)
+			return
+		}
+		// Reading is needed to answer pings and to notice the close
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Join adds conn to room, joining a room twice does nothing. ctx is passed to the presence callbacks.
+// The connection leaves all rooms by itself once it is closed.
+func (h *Hub) Join(ctx *Context, room string, conn *WebSocketConn) {
+	h.mu.Lock()
+	c, ok := h.clients[conn]
+	if !ok {
+		c = &hubClient{
+			ctx:   ctx,
+			conn:  conn,
+			send:  make(chan hubMessage, h.bufferSize),
+			rooms: make(map[string]struct{}),
+		}
+		h.clients[conn] = c
+		go h.writeLoop(c)
+	}
+	if _, joined := c.rooms[room]; joined {
+		h.mu.Unlock()
+		return
+	}
+	c.rooms[room] = struct{}{}
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[*hubClient]struct{})
+		h.rooms[room] = members
+	}
+	members[c] = struct{}{}
+	h.mu.Unlock()
+
+	if h.onJoin != nil {
+		h.onJoin(room, c.ctx, conn)
+	}
+}
+
+// Leave removes conn from room
+func (h *Hub) Leave(room string, conn *WebSocketConn) {
+	h.mu.Lock()
+	c, ok := h.clients[conn]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	if _, joined := c.rooms[room]; !joined {
+		h.mu.Unlock()
+		return
+	}
+	h.removeLocked(c, room)
+	h.mu.Unlock()
+
+	if h.onLeave != nil {
+		h.onLeave(room, c.ctx, conn)
+	}
+}
+
+// Broadcast queues a message to every connection in room. Connections whose buffers are full are evicted.
+func (h *Hub) Broadcast(room string, typ WebSocketMessageType, data []byte) {
+	var slow []*WebSocketConn
+	h.mu.RLock()
+	for c := range h.rooms[room] {
+		select {
+		case c.send <- hubMessage{typ: typ, data: data}:
+		default:
+			slow = append(slow, c.conn)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range slow {
+		h.leaveAll(conn, true)
+	}
+}
+
+// Count is the number of connections in room
+func (h *Hub) Count(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// writeLoop writes the queued messages of c until it leaves all rooms or is closed
+func (h *Hub) writeLoop(c *hubClient) {
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := c.conn.WriteMessage(msg.typ, msg.data); err != nil {
+				h.leaveAll(c.conn, false)
+				return
+			}
+		case <-c.conn.Done():
+			h.leaveAll(c.conn, false)
+			return
+		}
+	}
+}
+
+// leaveAll removes conn from all rooms, and closes it if evicted
+func (h *Hub) leaveAll(conn *WebSocketConn, evict bool) {
+	h.mu.Lock()
+	c, ok := h.clients[conn]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+		h.removeLocked(c, room)
+	}
+	h.mu.Unlock()
+
+	if evict {
+		// The writer of a slow client may hold the connection for a while, do not block the broadcaster
+		go conn.Close(ClosePolicyViolation, "slow consumer")
+	}
+	if h.onLeave != nil {
+		for _, room := range rooms {
+			h.onLeave(room, c.ctx, conn)
+		}
+	}
+}
+
+// removeLocked removes c from room, and drops c once it is in no room. h.mu must be held.
+func (h *Hub) removeLocked(c *hubClient, room string) {
+	delete(c.rooms, room)
+	if members := h.rooms[room]; members != nil {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	if len(c.rooms) == 0 {
+		delete(h.clients, c.conn)
+		// Broadcasters hold h.mu while sending, so nothing is sent after closing
+		close(c.send)
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// presenceLog records presence callbacks
+type presenceLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (p *presenceLog) record(event string) PresenceFunc {
+	return func(room string, ctx *Context, conn *WebSocketConn) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.events = append(p.events, event+" "+room+" "+ctx.Req.URL.Query().Get("user"))
+	}
+}
+
+func (p *presenceLog) sorted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := append([]string(nil), p.events...)
+	sort.Strings(res)
+	return res
+}
+
+// Test: broadcast to rooms by path params, with presence
+func TestHub_Broadcast(t *testing.T) {
+	log := &presenceLog{}
+	hub := NewHub(HubWithOnJoin(log.record("join")), HubWithOnLeave(log.record("leave")))
+	h := NewHTTPServer()
+	h.WebSocket("/ws/room/:id", hub.Handle("id", nil))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	dial := func(room, user string) *WebSocketConn {
+		conn, _, err := DialWebSocket(context.Background(), server.URL+"/ws/room/"+room+"?user="+user, nil)
+		require.NoError(t, err)
+		return conn
+	}
+	tom, jerry, spike := dial("1", "tom"), dial("1", "jerry"), dial("2", "spike")
+	require.Eventually(t, func() bool {
+		return hub.Count("1") == 2 && hub.Count("2") == 1
+	}, time.Second, time.Millisecond)
+
+	hub.Broadcast("1", TextMessage, []byte("to room 1"))
+	hub.Broadcast("2", TextMessage, []byte("to room 2"))
+	hub.Broadcast("3", TextMessage, []byte("nobody"))
+	for _, conn := range []*WebSocketConn{tom, jerry} {
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, "to room 1", string(msg))
+	}
+	_, msg, err := spike.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "to room 2", string(msg))
+
+	for _, conn := range []*WebSocketConn{tom, jerry, spike} {
+		conn.Close(CloseNormalClosure, "")
+	}
+	require.Eventually(t, func() bool {
+		return hub.Count("1") == 0 && hub.Count("2") == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{
+		"join 1 jerry", "join 1 tom", "join 2 spike",
+		"leave 1 jerry", "leave 1 tom", "leave 2 spike",
+	}, log.sorted())
+}
+
+// Test: a client not reading is evicted once its buffer is full
+func TestHub_SlowConsumer(t *testing.T) {
+	left := make(chan string, 2)
+	hub := NewHub(HubWithBufferSize(1), HubWithOnLeave(func(room string, ctx *Context, conn *WebSocketConn) {
+		left <- room
+	}))
+	// Writes to a pipe block until the other end reads
+	serverEnd, clientEnd := net.Pipe()
+	defer clientEnd.Close()
+	conn := newWebSocketConn(serverEnd, bufio.NewReader(serverEnd), false, defaultWebSocketMaxMessageSize)
+	ctx := &Context{Req: httptest.NewRequest("GET", "/ws/room/1", nil)}
+	hub.Join(ctx, "1", conn)
+	hub.Join(ctx, "2", conn)
+
+	// the first is being written, the second is buffered
+	hub.Broadcast("1", TextMessage, []byte("a"))
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return len(hub.clients[conn].send) == 0
+	}, time.Second, time.Millisecond)
+	hub.Broadcast("1", TextMessage, []byte("b"))
+	assert.Equal(t, 2, hub.Count("1")+hub.Count("2"))
+
+	hub.Broadcast("1", TextMessage, []byte("c"))
+	assert.Equal(t, 0, hub.Count("1"))
+	assert.Equal(t, 0, hub.Count("2"))
+	rooms := []string{<-left, <-left}
+	sort.Strings(rooms)
+	assert.Equal(t, []string{"1", "2"}, rooms)
+}
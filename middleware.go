@@ -0,0 +1,28 @@
+package web
+
+import "net/http"
+
+// Middleware wraps a HandleFunc with extra behaviors, e.g. logging, recovering.
+// Middlewares run in the order they are registered, the first one is the outermost.
+type Middleware func(next HandleFunc) HandleFunc
+
+// HTTPMiddleware adapts a standard net/http middleware, so that it can be used in the chain
+func HTTPMiddleware(m func(http.Handler) http.Handler) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			// The writer and the request of the standard middleware are valid only inside it
+			resp, req, urlQueries := ctx.Resp, ctx.Req, ctx.urlQueries
+			defer func() {
+				ctx.Resp, ctx.Req, ctx.urlQueries = resp, req, urlQueries
+			}()
+			m(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				// The standard middleware may have wrapped the writer or replaced the request
+				if request != ctx.Req {
+					ctx.urlQueries = nil
+				}
+				ctx.Resp, ctx.Req = writer, request
+				next(ctx)
+			})).ServeHTTP(resp, req)
+		}
+	}
+}
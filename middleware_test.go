@@ -0,0 +1,83 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: middlewares run in the order they are registered, wrapping the handler
+func TestHTTPServer_Use(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				calls = append(calls, name+" before")
+				next(ctx)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+
+	h := NewHTTPServer(ServerWithMiddleware(mark("first")))
+	h.Use(mark("second"))
+	h.Get("/", func(ctx *Context) {
+		calls = append(calls, "handler")
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"first before", "second before", "handler", "second after", "first after"}, calls)
+
+	// middlewares run for unmatched requests as well
+	calls = nil
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/no", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, calls)
+}
+
+// Test: a standard net/http middleware can replace the writer and the request
+func TestHTTPMiddleware(t *testing.T) {
+	type ctxKey struct{}
+	std := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("X-Std", "yes")
+			request = request.WithContext(context.WithValue(request.Context(), ctxKey{}, "value"))
+			next.ServeHTTP(&stdWriter{ResponseWriter: writer}, request)
+		})
+	}
+
+	h := NewHTTPServer()
+	// the outer middleware gets its writer and request back
+	var outerResp, afterResp http.ResponseWriter
+	var outerReq, afterReq *http.Request
+	h.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			outerResp, outerReq = ctx.Resp, ctx.Req
+			next(ctx)
+			afterResp, afterReq = ctx.Resp, ctx.Req
+		}
+	})
+	h.Use(HTTPMiddleware(std))
+	var got any
+	var gotResp http.ResponseWriter
+	h.Get("/", func(ctx *Context) {
+		got = ctx.Req.Context().Value(ctxKey{})
+		gotResp = ctx.Resp
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "value", got)
+	assert.IsType(t, &stdWriter{}, gotResp)
+	assert.Equal(t, "yes", recorder.Header().Get("X-Std"))
+	assert.Same(t, outerResp, afterResp)
+	assert.Same(t, outerReq, afterReq)
+}
+
+// stdWriter is a writer wrapped by a standard middleware
+type stdWriter struct {
+	http.ResponseWriter
+}
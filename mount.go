@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mountMethods are the methods a mounted handler is listed for, e.g. by CORS. Other methods reach it too.
+var mountMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+type mountConfig struct {
+	stripPrefix bool
+}
+
+// MountOption configures a mounted handler
+type MountOption func(cfg *mountConfig)
+
+// MountKeepPrefix passes the full path to the mounted handler instead of stripping the prefix
+func MountKeepPrefix() MountOption {
+	return func(cfg *mountConfig) {
+		cfg.stripPrefix = false
+	}
+}
+
+// Mount delegates requests of all methods under prefix to handler, e.g. pprof or another HTTPServer.
+// Methods without a route of their own, like PROPFIND of WebDAV, are delegated too.
+// The prefix is stripped from the path before delegating unless MountKeepPrefix is given.
+// Either way, the path after prefix is available by ctx.PathValue("*").
+func (h *HTTPServer) Mount(prefix string, handler http.Handler, opts ...MountOption) {
+	cfg := &mountConfig{stripPrefix: true}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	handleFunc := func(ctx *Context) {
+		req := ctx.Req
+		if cfg.stripPrefix && prefix != "/" {
+			req = stripPrefix(req, prefix)
+		}
+		handler.ServeHTTP(ctx.Resp, req)
+	}
+
+	wildcardPath := prefix + "/*"
+	if prefix == "/" {
+		wildcardPath = "/*"
+	}
+	for _, method := range append(mountMethods, anyMethod) {
+		h.AddRoute(method, prefix, handleFunc)
+		h.AddRoute(method, wildcardPath, handleFunc)
+	}
+}
+
+// stripPrefix returns a shallow copy of req whose path has prefix removed, like http.StripPrefix
+func stripPrefix(req *http.Request, prefix string) *http.Request {
+	p := "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	var rawPath string
+	if req.URL.RawPath != "" {
+		rawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.RawPath, prefix), "/")
+	}
+
+	stripped := new(http.Request)
+	*stripped = *req
+	stripped.URL = new(url.URL)
+	*stripped.URL = *req.URL
+	stripped.URL.Path = p
+	stripped.URL.RawPath = rawPath
+	return stripped
+}
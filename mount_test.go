@@ -0,0 +1,171 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: mount a http.Handler and another HTTPServer under prefixes
+func TestHTTPServer_Mount(t *testing.T) {
+	echoPath := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.Method + " " + request.URL.Path))
+	})
+
+	sub := NewHTTPServer()
+	sub.Get("/users/:id", func(ctx *Context) {
+		ctx.Resp.Write([]byte("sub user " + ctx.PathValue("id")))
+	})
+
+	h := NewHTTPServer()
+	var rest string
+	h.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			rest = ctx.PathValue("*")
+		}
+	})
+	h.Mount("/debug", echoPath)
+	h.Mount("/keep", echoPath, MountKeepPrefix())
+	h.Mount("/team", sub)
+
+	testCases := []struct {
+		caseName string
+		method   string
+		url      string
+		wantCode int
+		wantBody string
+		wantRest string
+	}{
+		{
+			caseName: "strip prefix",
+			method:   http.MethodGet,
+			url:      "/debug/pprof/heap",
+			wantCode: http.StatusOK,
+			wantBody: "GET /pprof/heap",
+			wantRest: "pprof/heap",
+		},
+		{
+			caseName: "prefix itself",
+			method:   http.MethodDelete,
+			url:      "/debug",
+			wantCode: http.StatusOK,
+			wantBody: "DELETE /",
+		},
+		{
+			caseName: "keep prefix",
+			method:   http.MethodPost,
+			url:      "/keep/a/b",
+			wantCode: http.StatusOK,
+			wantBody: "POST /keep/a/b",
+			wantRest: "a/b",
+		},
+		{
+			caseName: "custom method",
+			method:   "PROPFIND",
+			url:      "/debug/files",
+			wantCode: http.StatusOK,
+			wantBody: "PROPFIND /files",
+			wantRest: "files",
+		},
+		{
+			caseName: "sub-server",
+			method:   http.MethodGet,
+			url:      "/team/users/42",
+			wantCode: http.StatusOK,
+			wantBody: "sub user 42",
+			wantRest: "users/42",
+		},
+		{
+			caseName: "sub-server not found",
+			method:   http.MethodPost,
+			url:      "/team/users/42",
+			wantCode: http.StatusNotFound,
+			wantBody: "404 page not found\n",
+			wantRest: "users/42",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantRest, rest)
+		})
+	}
+}
+
+// Test: a route of a custom method is preferred to the mount, and the mount does not catch paths outside prefix
+func TestHTTPServer_MountCustomMethod(t *testing.T) {
+	echoMethod := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("mount " + request.Method))
+	})
+	h := NewHTTPServer()
+	h.Mount("/dav", echoMethod)
+	h.AddRoute("MKCOL", "/dav/reserved", func(ctx *Context) {
+		ctx.Resp.Write([]byte("route MKCOL"))
+	})
+
+	testCases := []struct {
+		caseName string
+		method   string
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{caseName: "Mounted", method: "MKCOL", url: "/dav/new", wantCode: http.StatusOK, wantBody: "mount MKCOL"},
+		{caseName: "Route", method: "MKCOL", url: "/dav/reserved", wantCode: http.StatusOK, wantBody: "route MKCOL"},
+		{caseName: "Outside prefix", method: "PROPFIND", url: "/other", wantCode: http.StatusNotFound,
+			wantBody: "404 page not found\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+// Test: the path policies still apply to the routes next to a handler mounted at the root
+func TestHTTPServer_MountRoot(t *testing.T) {
+	h := NewHTTPServer()
+	h.Mount("/", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("mount " + request.Method + " " + request.URL.Path))
+	}))
+	h.Get("/user/home", func(ctx *Context) {
+		ctx.Resp.Write([]byte("home"))
+	})
+
+	testCases := []struct {
+		caseName     string
+		method       string
+		url          string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{
+		{caseName: "Route", method: http.MethodGet, url: "/user/home", wantCode: http.StatusOK, wantBody: "home"},
+		{caseName: "Trailing slash", method: http.MethodGet, url: "/user/home/", wantCode: http.StatusMovedPermanently,
+			wantLocation: "/user/home"},
+		{caseName: "Next to the route", method: http.MethodGet, url: "/user/other", wantCode: http.StatusOK,
+			wantBody: "mount GET /user/other"},
+		{caseName: "Custom method", method: "PROPFIND", url: "/user/home/", wantCode: http.StatusOK,
+			wantBody: "mount PROPFIND /user/home/"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package web
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitResult is the decision on a request
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the quota, the burst of TokenBucket or the limit of SlidingWindow
+	Limit int
+	// Remaining is the quota left after this request
+	Remaining int
+	// Reset is how long until the quota is fully available again
+	Reset time.Duration
+	// RetryAfter is how long until a request is allowed again, when not allowed
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request of key is allowed, and keeps the usage of keys
+type Limiter interface {
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+}
+
+// RateLimitState is the state of a key, kept by a Limiter between requests and updated by a RateLimitAlgorithm
+type RateLimitState struct {
+	// Value is the tokens left for TokenBucket, or the count of the current window for SlidingWindow
+	Value float64
+	// Previous is the count of the previous window for SlidingWindow
+	Previous float64
+	// Time is the last refill for TokenBucket, or the start of the current window for SlidingWindow.
+	// Zero for a new key.
+	Time time.Time
+}
+
+// RateLimitAlgorithm updates the state of a key for a request, so that stores other than memory can reuse it
+type RateLimitAlgorithm interface {
+	Take(state *RateLimitState, now time.Time) RateLimitResult
+	// TTL is how long the state of an idle key must be kept, it is as good as new after that
+	TTL() time.Duration
+}
+
+// TokenBucket allows bursts of burst requests, refilled by rate requests per second
+func TokenBucket(rate float64, burst int) RateLimitAlgorithm {
+	if rate <= 0 || burst <= 0 {
+		panic("rate and burst of token bucket should be positive")
+	}
+	return tokenBucket{rate: rate, burst: float64(burst)}
+}
+
+type tokenBucket struct {
+	rate  float64
+	burst float64
+}
+
+func (b tokenBucket) Take(state *RateLimitState, now time.Time) RateLimitResult {
+	tokens := b.burst
+	if !state.Time.IsZero() {
+		tokens = math.Min(b.burst, state.Value+now.Sub(state.Time).Seconds()*b.rate)
+	}
+	res := RateLimitResult{Limit: int(b.burst)}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = b.duration(1 - tokens)
+	}
+	state.Value, state.Time = tokens, now
+	res.Remaining = int(tokens)
+	res.Reset = b.duration(b.burst - tokens)
+	return res
+}
+
+func (b tokenBucket) TTL() time.Duration {
+	return b.duration(b.burst)
+}
+
+// duration is the time to refill tokens
+func (b tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+// SlidingWindow allows limit requests in any window of the length window. The count of the previous window
+// is weighted by how much of it overlaps the sliding window, so only two counters are kept per key.
+func SlidingWindow(limit int, window time.Duration) RateLimitAlgorithm {
+	if limit <= 0 || window <= 0 {
+		panic("limit and window of sliding window should be positive")
+	}
+	return slidingWindow{limit: float64(limit), window: window}
+}
+
+type slidingWindow struct {
+	limit  float64
+	window time.Duration
+}
+
+func (w slidingWindow) Take(state *RateLimitState, now time.Time) RateLimitResult {
+	start := now.Truncate(w.window)
+	if !state.Time.Equal(start) {
+		if state.Time.Equal(start.Add(-w.window)) {
+			state.Previous = state.Value
+		} else {
+			state.Previous = 0
+		}
+		state.Value, state.Time = 0, start
+	}
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(w.window)
+	used := state.Previous*weight + state.Value
+
+	res := RateLimitResult{Limit: int(w.limit), Reset: w.window - elapsed}
+	if used+1 <= w.limit {
+		state.Value++
+		used++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = w.retryAfter(state, elapsed)
+	}
+	if state.Value > 0 {
+		// the current window still counts until the end of the next one
+		res.Reset += w.window
+	}
+	res.Remaining = int(math.Max(0, math.Floor(w.limit-used)))
+	return res
+}
+
+// retryAfter solves when one more request fits, within the current window or the next one
+func (w slidingWindow) retryAfter(state *RateLimitState, elapsed time.Duration) time.Duration {
+	window := float64(w.window)
+	if state.Value+1 <= w.limit && state.Previous > 0 {
+		t := window*(1-(w.limit-1-state.Value)/state.Previous) - float64(elapsed)
+		if t <= float64(w.window-elapsed) {
+			return time.Duration(math.Max(t, 0))
+		}
+	}
+	if state.Value == 0 {
+		return w.window - elapsed
+	}
+	return w.window - elapsed + time.Duration(math.Max(window*(1-(w.limit-1)/state.Value), 0))
+}
+
+func (w slidingWindow) TTL() time.Duration {
+	return 2 * w.window
+}
+
+// memoryLimiterShards splits the keys of MemoryLimiter, so that requests of different keys rarely wait for a lock
+const memoryLimiterShards = 32
+
+// MemoryLimiter is a Limiter keeping the states in memory, sharded by keys
+type MemoryLimiter struct {
+	algorithm RateLimitAlgorithm
+	shards    [memoryLimiterShards]limiterShard
+}
+
+type limiterShard struct {
+	mu        sync.Mutex
+	states    map[string]*RateLimitState
+	nextSweep time.Time
+}
+
+// NewMemoryLimiter constructs a MemoryLimiter of algorithm
+func NewMemoryLimiter(algorithm RateLimitAlgorithm) *MemoryLimiter {
+	l := &MemoryLimiter{algorithm: algorithm}
+	for i := range l.shards {
+		l.shards[i].states = make(map[string]*RateLimitState)
+	}
+	return l
+}
+
+// Allow takes a request of key
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	shard := &l.shards[hash.Sum32()%memoryLimiterShards]
+
+	now := time.Now()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	state, ok := shard.states[key]
+	if !ok {
+		state = &RateLimitState{}
+		shard.states[key] = state
+	}
+	res := l.algorithm.Take(state, now)
+
+	// Sweep idle keys lazily instead of running a goroutine
+	if now.After(shard.nextSweep) {
+		ttl := l.algorithm.TTL()
+		for k, s := range shard.states {
+			if now.Sub(s.Time) > ttl {
+				delete(shard.states, k)
+			}
+		}
+		shard.nextSweep = now.Add(ttl)
+	}
+	return res, nil
+}
+
+// RateLimitConfig configures the rate limit middleware
+type RateLimitConfig struct {
+	Limiter Limiter
+	// Key gets the key to limit a request by. Default is RateLimitByIP.
+	// Requests whose key is empty share one quota.
+	Key func(ctx *Context) string
+}
+
+// RateLimit is the rate limit middleware. Every response gets RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, a request over the limit gets 429 with Retry-After by the error handler.
+// Use it on a Group for the limits of some routes, keys by path params work only there, after routing.
+func RateLimit(cfg RateLimitConfig) Middleware {
+	if cfg.Limiter == nil {
+		panic("rate limiter is nil")
+	}
+	if cfg.Key == nil {
+		cfg.Key = RateLimitByIP
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			res, err := cfg.Limiter.Allow(ctx.Req.Context(), cfg.Key(ctx))
+			if err != nil {
+				ctx.Error(err)
+				return
+			}
+			header := ctx.Resp.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			if !res.Allowed {
+				header.Set("Retry-After", ceilSeconds(res.RetryAfter))
+				ctx.Error(NewHTTPError(http.StatusTooManyRequests, ""))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// RateLimitByIP keys requests by the IP of the client connection.
+// Behind a proxy, use a key of the header set by the proxy instead, e.g. RateLimitByHeader("X-Real-IP").
+func RateLimitByIP(ctx *Context) string {
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		return ctx.Req.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitByHeader keys requests by header name, e.g. "X-API-Key"
+func RateLimitByHeader(name string) func(ctx *Context) string {
+	return func(ctx *Context) string {
+		return ctx.Req.Header.Get(name)
+	}
+}
+
+// RateLimitByPathParam keys requests by the path param name, e.g. "tenant" of "/tenants/:tenant/orders"
+func RateLimitByPathParam(name string) func(ctx *Context) string {
+	return func(ctx *Context) string {
+		return ctx.PathValue(name)
+	}
+}
+
+// ceilSeconds formats d in whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test: token bucket allows bursts, then the refill rate
+func TestTokenBucket(t *testing.T) {
+	bucket := TokenBucket(2, 3)
+	state := &RateLimitState{}
+	now := time.Unix(1000, 0)
+
+	testCases := []struct {
+		caseName string
+		after    time.Duration
+		want     RateLimitResult
+	}{
+		{caseName: "New key", want: RateLimitResult{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+		{caseName: "Burst", want: RateLimitResult{Allowed: true, Limit: 3, Remaining: 1, Reset: time.Second}},
+		{caseName: "Burst used up", want: RateLimitResult{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+		{caseName: "Denied", want: RateLimitResult{Limit: 3, Reset: 1500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{caseName: "Refilled", after: 500 * time.Millisecond,
+			want: RateLimitResult{Allowed: true, Limit: 3, Remaining: 0, Reset: 1500 * time.Millisecond}},
+		{caseName: "Full after idle", after: time.Hour, want: RateLimitResult{Allowed: true, Limit: 3, Remaining: 2, Reset: 500 * time.Millisecond}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			now = now.Add(tc.after)
+			assert.Equal(t, tc.want, bucket.Take(state, now))
+		})
+	}
+}
+
+// Test: sliding window weights the previous window
+func TestSlidingWindow(t *testing.T) {
+	window := SlidingWindow(4, time.Minute)
+	state := &RateLimitState{}
+	start := time.Unix(0, 0).Add(1000 * time.Minute)
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, window.Take(state, start.Add(30*time.Second)).Allowed)
+	}
+	res := window.Take(state, start.Add(30*time.Second))
+	assert.Equal(t, RateLimitResult{Limit: 4, Reset: 90 * time.Second, RetryAfter: 45 * time.Second}, res)
+
+	// 3/4 of the previous window overlaps: 4*0.75 = 3 used
+	res = window.Take(state, start.Add(75*time.Second))
+	assert.Equal(t, RateLimitResult{Allowed: true, Limit: 4, Remaining: 0, Reset: 105 * time.Second}, res)
+	res = window.Take(state, start.Add(75*time.Second))
+	assert.False(t, res.Allowed)
+	// 4*(1-x)+1+1 <= 4 when x = 1/2
+	assert.Equal(t, 15*time.Second, res.RetryAfter)
+	assert.True(t, window.Take(state, start.Add(90*time.Second)).Allowed)
+
+	// windows long ago do not count
+	res = window.Take(state, start.Add(10*time.Minute))
+	assert.Equal(t, RateLimitResult{Allowed: true, Limit: 4, Remaining: 3, Reset: 2 * time.Minute}, res)
+}
+
+// Test: a limit of 1 waits for the previous window to pass entirely
+func TestSlidingWindow_LimitOne(t *testing.T) {
+	window := SlidingWindow(1, time.Minute)
+	state := &RateLimitState{}
+	start := time.Unix(0, 0).Add(1000 * time.Minute)
+
+	testCases := []struct {
+		caseName string
+		at       time.Duration
+		want     RateLimitResult
+	}{
+		{caseName: "First", at: 10 * time.Second,
+			want: RateLimitResult{Allowed: true, Limit: 1, Remaining: 0, Reset: 110 * time.Second}},
+		{caseName: "Same window", at: 20 * time.Second,
+			want: RateLimitResult{Limit: 1, Reset: 100 * time.Second, RetryAfter: 100 * time.Second}},
+		{caseName: "Early in the next window", at: 65 * time.Second,
+			want: RateLimitResult{Limit: 1, Reset: 55 * time.Second, RetryAfter: 55 * time.Second}},
+		{caseName: "Previous window passed", at: 120 * time.Second,
+			want: RateLimitResult{Allowed: true, Limit: 1, Remaining: 0, Reset: 2 * time.Minute}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			assert.Equal(t, tc.want, window.Take(state, start.Add(tc.at)))
+		})
+	}
+}
+
+// Test: limits by path params of a group, responded by the error handler
+func TestRateLimit(t *testing.T) {
+	h := NewHTTPServer(ServerWithErrorHandler(func(ctx *Context, err error) {
+		ctx.Resp.WriteHeader(err.(*HTTPError).Code)
+		ctx.Resp.Write([]byte(`{"error":"` + err.Error() + `"}`))
+	}))
+	tenants := h.Group("/tenants/:tenant", RateLimit(RateLimitConfig{
+		Limiter: NewMemoryLimiter(TokenBucket(0.1, 2)),
+		Key:     RateLimitByPathParam("tenant"),
+	}))
+	tenants.Get("/orders", func(ctx *Context) {
+		ctx.Resp.Write([]byte("orders"))
+	})
+
+	do := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+	recorder := do("/tenants/a/orders")
+	assert.Equal(t, "orders", recorder.Body.String())
+	assert.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", recorder.Header().Get("RateLimit-Reset"))
+	do("/tenants/a/orders")
+
+	recorder = do("/tenants/a/orders")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, `{"error":"Too Many Requests"}`, recorder.Body.String())
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", recorder.Header().Get("Retry-After"))
+
+	// another tenant has its own quota
+	assert.Equal(t, http.StatusOK, do("/tenants/b/orders").Code)
+}
+
+// Test: keys by IP and header
+func TestRateLimit_Keys(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-API-Key", "key1")
+	ctx := &Context{Req: req}
+	assert.Equal(t, "192.0.2.1", RateLimitByIP(ctx))
+	assert.Equal(t, "key1", RateLimitByHeader("X-API-Key")(ctx))
+
+	limiter := NewMemoryLimiter(SlidingWindow(1, time.Hour))
+	res, err := limiter.Allow(req.Context(), "key1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = limiter.Allow(req.Context(), "key1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	res, err = limiter.Allow(req.Context(), "key2")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
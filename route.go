@@ -0,0 +1,177 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteOption configures a route when it is added
+type RouteOption func(rh *routeHandler)
+
+// routeHandler is a handler added to a node, with the matchers deciding whether it serves a request
+type routeHandler struct {
+	handler  HandleFunc
+	matchers []matcher
+	name     string // for reverse routing, see RouteName
+}
+
+// RouteName names the route, so that its URL can be built by HTTPServer.URLFor, e.g. in templates
+func RouteName(name string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.name = name
+	}
+}
+
+// matcher tells whether a request can be served by a handler
+type matcher struct {
+	match func(req *http.Request) bool
+	// code to respond when no handler of the node matches because of this matcher
+	code int
+}
+
+// pickHandler picks the handler for req. Handlers with matchers are tried in the order they are added,
+// the first one whose matchers all match wins, the handler without matchers is the fallback.
+// If none matches, it returns the status code to respond: 415 > 406 > 404.
+func (n *node) pickHandler(req *http.Request) (HandleFunc, int) {
+	code := http.StatusNotFound
+	for _, rh := range n.matchedHandlers {
+		failedCode, ok := rh.match(req)
+		if ok {
+			return rh.handler, http.StatusOK
+		}
+		if failedCode == http.StatusUnsupportedMediaType ||
+			(failedCode == http.StatusNotAcceptable && code == http.StatusNotFound) {
+			code = failedCode
+		}
+	}
+	if n.handler != nil {
+		return n.handler, http.StatusOK
+	}
+	return nil, code
+}
+
+// match checks the matchers one by one, returns the code of the first failed one
+func (rh *routeHandler) match(req *http.Request) (int, bool) {
+	for _, m := range rh.matchers {
+		if !m.match(req) {
+			return m.code, false
+		}
+	}
+	return http.StatusOK, true
+}
+
+// headerCode is the code to respond when a header does not match
+func headerCode(key string) int {
+	switch http.CanonicalHeaderKey(key) {
+	case "Accept":
+		return http.StatusNotAcceptable
+	case "Content-Type":
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusNotFound
+}
+
+// MatchHeader matches requests whose header key equals value
+func MatchHeader(key, value string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				return req.Header.Get(key) == value
+			},
+			code: headerCode(key),
+		})
+	}
+}
+
+// MatchHeaderRegexp matches requests whose header key matches the regexp expr
+func MatchHeaderRegexp(key, expr string) RouteOption {
+	re := regexp.MustCompile(expr)
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				return re.MatchString(req.Header.Get(key))
+			},
+			code: headerCode(key),
+		})
+	}
+}
+
+// MatchAccept matches requests accepting any of mediaTypes, e.g. "application/vnd.x.v2+json".
+// Only exact media types in the Accept header count, wildcards like "*/*" are ignored.
+func MatchAccept(mediaTypes ...string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				for _, accepted := range strings.Split(req.Header.Get("Accept"), ",") {
+					if containsMediaType(mediaTypes, accepted) {
+						return true
+					}
+				}
+				return false
+			},
+			code: http.StatusNotAcceptable,
+		})
+	}
+}
+
+// MatchContentType matches requests whose Content-Type is any of mediaTypes, params like charset are ignored
+func MatchContentType(mediaTypes ...string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				return containsMediaType(mediaTypes, req.Header.Get("Content-Type"))
+			},
+			code: http.StatusUnsupportedMediaType,
+		})
+	}
+}
+
+// MatchQuery matches requests having the query param key, e.g. "?version=2" or "?debug"
+func MatchQuery(key string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				return req.URL.Query().Has(key)
+			},
+			code: http.StatusNotFound,
+		})
+	}
+}
+
+// MatchQueryValue matches requests whose query param key equals value
+func MatchQueryValue(key, value string) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: func(req *http.Request) bool {
+				return req.URL.Query().Get(key) == value
+			},
+			code: http.StatusNotFound,
+		})
+	}
+}
+
+// MatchFunc matches requests with a custom predicate
+func MatchFunc(fn func(req *http.Request) bool) RouteOption {
+	return func(rh *routeHandler) {
+		rh.matchers = append(rh.matchers, matcher{
+			match: fn,
+			code:  http.StatusNotFound,
+		})
+	}
+}
+
+// containsMediaType reports whether the media type of value is one of mediaTypes
+func containsMediaType(mediaTypes []string, value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	for _, t := range mediaTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: several handlers on one node, the first matching one wins
+func TestHTTPServer_RouteMatchers(t *testing.T) {
+	reply := func(name string) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Resp.Write([]byte(name))
+		}
+	}
+
+	h := NewHTTPServer()
+	h.Get("/items", reply("v2 accept"), MatchAccept("application/vnd.x.v2+json"))
+	h.Get("/items", reply("v2 query"), MatchQueryValue("version", "2"))
+	h.Get("/items", reply("debug"), MatchQuery("debug"), MatchHeaderRegexp("X-Debug-Token", `^\d+$`))
+	h.Get("/items", reply("v1"))
+	h.Post("/items", reply("json"), MatchContentType("application/json"))
+	h.Post("/items", reply("custom"), MatchFunc(func(req *http.Request) bool {
+		return req.Header.Get("X-Custom") != ""
+	}))
+	h.Get("/reports", reply("csv"), MatchHeader("Accept", "text/csv"))
+
+	testCases := []struct {
+		caseName string
+		method   string
+		url      string
+		header   map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseName: "accept header",
+			method:   http.MethodGet,
+			url:      "/items",
+			header:   map[string]string{"Accept": "text/html, application/vnd.x.v2+json;q=0.9"},
+			wantCode: http.StatusOK,
+			wantBody: "v2 accept",
+		},
+		{
+			caseName: "query value",
+			method:   http.MethodGet,
+			url:      "/items?version=2",
+			wantCode: http.StatusOK,
+			wantBody: "v2 query",
+		},
+		{
+			caseName: "all matchers must match",
+			method:   http.MethodGet,
+			url:      "/items?debug",
+			header:   map[string]string{"X-Debug-Token": "123"},
+			wantCode: http.StatusOK,
+			wantBody: "debug",
+		},
+		{
+			caseName: "fallback to handler without matchers",
+			method:   http.MethodGet,
+			url:      "/items?debug",
+			header:   map[string]string{"X-Debug-Token": "abc"},
+			wantCode: http.StatusOK,
+			wantBody: "v1",
+		},
+		{
+			caseName: "content type ignores params",
+			method:   http.MethodPost,
+			url:      "/items",
+			header:   map[string]string{"Content-Type": "application/json; charset=utf-8"},
+			wantCode: http.StatusOK,
+			wantBody: "json",
+		},
+		{
+			caseName: "custom predicate",
+			method:   http.MethodPost,
+			url:      "/items",
+			header:   map[string]string{"X-Custom": "1"},
+			wantCode: http.StatusOK,
+			wantBody: "custom",
+		},
+		{
+			caseName: "unsupported media type",
+			method:   http.MethodPost,
+			url:      "/items",
+			header:   map[string]string{"Content-Type": "text/xml"},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			caseName: "not acceptable",
+			method:   http.MethodGet,
+			url:      "/reports",
+			header:   map[string]string{"Accept": "application/json"},
+			wantCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			for key, value := range tc.header {
+				req.Header.Set(key, value)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_AddRouteWithMatchers(t *testing.T) {
+	var mockHandler = func(ctx *Context) {}
+	r := newRouter()
+
+	// handlers with matchers can share a node with the one without
+	assert.NotPanics(t, func() {
+		r.AddRoute(http.MethodGet, "/", mockHandler)
+		r.AddRoute(http.MethodGet, "/", mockHandler, MatchQuery("a"))
+		r.AddRoute(http.MethodGet, "/a", mockHandler, MatchQuery("a"))
+		r.AddRoute(http.MethodGet, "/a", mockHandler, MatchQuery("b"))
+		r.AddRoute(http.MethodGet, "/a", mockHandler)
+	})
+	assert.Panicsf(t, func() {
+		r.AddRoute(http.MethodGet, "/a", mockHandler)
+	}, "Duplicate node without matchers")
+
+	// a node with only matched handlers is still found
+	r.AddRoute(http.MethodGet, "/b", mockHandler, MatchQuery("b"))
+	n, _ := r.FindRoute(http.MethodGet, "/b")
+	assert.True(t, n.routable())
+	handler, code := n.pickHandler(httptest.NewRequest(http.MethodGet, "/b", nil))
+	assert.Nil(t, handler)
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -15,6 +16,9 @@ import (
 // :())
 // :3f
 var regexpRoutePattern, _ = regexp.Compile("((?::.*?)+)\\((.*)\\)") // ((?::.*?)+)\((.*)\) capture 1.keys 2.regexp
+// wildcardParamKey is the param key of what a trailing wildcard pairs
+const wildcardParamKey = "*"
+
 // node of a router tree
 type node struct {
 	path          string           // sub-path of this node
@@ -24,11 +28,21 @@ type node struct {
 	wildcardChild *node // wildcardChild child node
 	paramChild    *node // param child node
 	handler       HandleFunc
+	// handlers with matchers, tried in order before handler, see RouteOption
+	matchedHandlers []*routeHandler
 }
 
+// anyMethod is the method of the tree tried for the methods without a route, e.g. WebDAV ones for a mounted
+// handler. No request has an empty method.
+const anyMethod = ""
+
 // router tree (actually router forest)
 type router struct {
-	trees map[string]*node // methods trees
+	trees map[string]*node  // methods trees
+	names map[string]string // route name --> path, see RouteName
+	// FindRoute receives escaped paths, e.g. URL.EscapedPath().
+	// Sub-paths are unescaped only after splitting, so an encoded '/' stays in one param value.
+	useRawPath bool
 }
 
 // newRouter Creates a new router
@@ -40,7 +54,22 @@ func newRouter() *router {
 
 // AddRoute adds a route in the router of method
 // Path limitation: start with '/', end without '/', no continuous '/'
-func (r *router) AddRoute(method string, path string, handleFunc HandleFunc) {
+// With matchers in opts, several handlers can be added to the same path, see RouteOption.
+func (r *router) AddRoute(method string, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	rh := &routeHandler{handler: handleFunc}
+	for _, opt := range opts {
+		opt(rh)
+	}
+	if rh.name != "" {
+		if p, ok := r.names[rh.name]; ok && p != path {
+			panic("Duplicate route name " + rh.name)
+		}
+		if r.names == nil {
+			r.names = make(map[string]string)
+		}
+		r.names[rh.name] = path
+	}
+
 	// Validate path
 	if path == "" {
 		panic("empty path")
@@ -63,10 +92,10 @@ func (r *router) AddRoute(method string, path string, handleFunc HandleFunc) {
 	}
 
 	if path == "/" {
-		if root.handler != nil {
+		if root.handler != nil && len(rh.matchers) == 0 {
 			panic("Duplicate root node")
 		}
-		root.handler = handleFunc
+		root.addHandler(rh)
 		return
 	}
 
@@ -79,7 +108,7 @@ func (r *router) AddRoute(method string, path string, handleFunc HandleFunc) {
 		child := root.getOrCreateChild(subPath)
 		root = child
 	}
-	if root.handler != nil {
+	if root.handler != nil && len(rh.matchers) == 0 {
 		panic("Duplicate node")
 	}
 	// for trailing wildcard, I make it points to itself, so that can pairs anything left
@@ -87,7 +116,33 @@ func (r *router) AddRoute(method string, path string, handleFunc HandleFunc) {
 	if subPaths[len(subPaths)-1] == "*" {
 		root.wildcardChild = root
 	}
-	root.handler = handleFunc
+	root.addHandler(rh)
+}
+
+// addHandler adds a handler to n. A handler without matchers becomes the fallback of n.
+func (n *node) addHandler(rh *routeHandler) {
+	if len(rh.matchers) == 0 {
+		n.handler = rh.handler
+		return
+	}
+	n.matchedHandlers = append(n.matchedHandlers, rh)
+}
+
+// routable reports whether n has any handler
+func (n *node) routable() bool {
+	return n.handler != nil || len(n.matchedHandlers) > 0
+}
+
+// clone copies p, so that the params paired after it are not kept
+func (p param) clone() param {
+	if p == nil {
+		return nil
+	}
+	cloned := make(param, len(p))
+	for key, value := range p {
+		cloned[key] = value
+	}
+	return cloned
 }
 
 // FindRoute finds a node of given method and path
@@ -103,10 +158,46 @@ func (r *router) FindRoute(method, path string) (*node, *param) {
 		return root, nil
 	}
 
-	path = strings.Trim(path, "/") // Remove leading and trailing '/'
+	// Only the leading '/' is removed. A trailing or continuous '/' makes an empty sub-path,
+	// which AddRoute never registers, so such paths are not matched here.
+	// It's up to the server to redirect them to the canonical path.
+	path = strings.TrimPrefix(path, "/")
 	subPaths := strings.Split(path, "/")
 	var params param
-	for _, subPath := range subPaths {
+	wildcardStart := -1 // where the trailing wildcard starts pairing sub-paths
+	// The nearest trailing wildcard passed by, e.g. "/a/*" for "/a/b/c" when only "/a/b/d" is registered.
+	// It pairs the rest of the path if the descent dead-ends.
+	var fallback *node
+	var fallbackStart int
+	var fallbackParams param
+	for i, subPath := range subPaths {
+		if wc := root.wildcardChild; wc != nil && wc.wildcardChild == wc && wc != root {
+			fallback, fallbackStart, fallbackParams = wc, i, params.clone()
+		}
+		if subPath == "" {
+			// a trailing wildcard pairs anything left, including empty sub-paths
+			if root.wildcardChild == root {
+				continue
+			}
+			// "/a/" pairs "/a/*" with nothing left
+			if i == len(subPaths)-1 && root.wildcardChild != nil && root.wildcardChild.wildcardChild == root.wildcardChild {
+				wildcardStart = i
+				root = root.wildcardChild
+				continue
+			}
+			// "/a/b/" is redirected to "/a/b" if that is a route, or falls back otherwise
+			if i == len(subPaths)-1 && fallback != nil && !root.routable() {
+				root, wildcardStart, params = fallback, fallbackStart, fallbackParams
+				break
+			}
+			return nil, nil
+		}
+		if r.useRawPath {
+			var err error
+			if subPath, err = url.PathUnescape(subPath); err != nil {
+				return nil, nil
+			}
+		}
 		// Priority: static > regexp > param > wildcard
 		if root.children[subPath] != nil {
 			root = root.children[subPath]
@@ -140,12 +231,34 @@ func (r *router) FindRoute(method, path string) (*node, *param) {
 			params[root.paramChild.path[1:]] = subPath
 			root = root.paramChild
 		} else if root.wildcardChild != nil {
+			if root.wildcardChild == root.wildcardChild.wildcardChild && root.wildcardChild != root {
+				wildcardStart = i
+			}
 			root = root.wildcardChild
+		} else if fallback != nil {
+			root, wildcardStart, params = fallback, fallbackStart, fallbackParams
+			break
 		} else {
 			// 404
 			return nil, nil
 		}
 	}
+	if fallback != nil && root != fallback && !root.routable() {
+		root, wildcardStart, params = fallback, fallbackStart, fallbackParams
+	}
+	// Save what the trailing wildcard paired, e.g. "b/c" for "/a/*" with "/a/b/c"
+	if root.wildcardChild == root && wildcardStart >= 0 {
+		rest := strings.Join(subPaths[wildcardStart:], "/")
+		if r.useRawPath {
+			if unescaped, err := url.PathUnescape(rest); err == nil {
+				rest = unescaped
+			}
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[wildcardParamKey] = rest
+	}
 	return root, &params
 }
 
@@ -199,3 +312,120 @@ func (n *node) getOrCreateChild(subPath string) *node {
 	}
 	return res
 }
+
+// encodedSlashPattern matches an escaped '/' in a path
+var encodedSlashPattern = regexp.MustCompile(`%2[fF]`)
+
+// findCaseInsensitivePath finds a route of method matching the escaped path case-insensitively.
+// It returns the path spelled the way the static parts were registered, while the parts matched by
+// param, regexp and wildcard nodes are kept as they were requested.
+func (r *router) findCaseInsensitivePath(method, path string) (string, bool) {
+	root, ok := r.trees[method]
+	if !ok {
+		return "", false
+	}
+	if path == "/" {
+		return path, root.routable()
+	}
+
+	subPaths := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if !r.useRawPath {
+		// FindRoute splits the unescaped path, where an encoded slash separates sub-paths too
+		var split []string
+		for _, rawSubPath := range subPaths {
+			split = append(split, encodedSlashPattern.Split(rawSubPath, -1)...)
+		}
+		subPaths = split
+	}
+	fixed := make([]string, 0, len(subPaths))
+	for _, rawSubPath := range subPaths {
+		subPath, err := url.PathUnescape(rawSubPath)
+		if err != nil || subPath == "" {
+			return "", false
+		}
+		// Priority is the same as FindRoute: static > regexp > param > wildcard
+		if child := root.children[subPath]; child != nil {
+			root = child
+			fixed = append(fixed, rawSubPath)
+			continue
+		}
+		var child *node
+		for childPath, c := range root.children {
+			if strings.EqualFold(childPath, subPath) {
+				child = c
+				break
+			}
+		}
+		switch {
+		case child != nil:
+			root = child
+			fixed = append(fixed, child.path)
+		case root.regexp != nil && root.regexp.MatchString(subPath):
+			root = root.regexpChild
+			fixed = append(fixed, rawSubPath)
+		case root.paramChild != nil:
+			root = root.paramChild
+			fixed = append(fixed, rawSubPath)
+		case root.wildcardChild != nil:
+			root = root.wildcardChild
+			fixed = append(fixed, rawSubPath)
+		default:
+			return "", false
+		}
+	}
+	if !root.routable() {
+		return "", false
+	}
+	return "/" + strings.Join(fixed, "/"), true
+}
+
+// URLFor builds the path of the route named name, params are pairs of key and value, e.g.
+// URLFor("user", "id", "42") --> "/user/42" for route "/user/:id".
+// A regexp sub-path is replaced as a whole by the value of its first key, "*" by the value of key "*".
+func (r *router) URLFor(name string, params ...string) (string, error) {
+	routePath, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("route %s not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("params of route %s should be pairs of key and value", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	if routePath == "/" {
+		return routePath, nil
+	}
+
+	subPaths := strings.Split(routePath[1:], "/")
+	for i, subPath := range subPaths {
+		var key string
+		switch {
+		case subPath == "*":
+			key = wildcardParamKey
+		case subPath[0] == ':':
+			key = subPath[1:]
+			if matches := regexpRoutePattern.FindStringSubmatch(subPath); len(matches) == 3 {
+				key = strings.Split(matches[1][1:], ":")[0]
+			}
+		default:
+			continue
+		}
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("param %s of route %s is missing", key, name)
+		}
+		if key == wildcardParamKey {
+			// a trailing wildcard keeps the '/'s of its value
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			subPaths[i] = strings.Join(parts, "/")
+			continue
+		}
+		subPaths[i] = url.PathEscape(value)
+	}
+	return "/" + strings.Join(subPaths, "/"), nil
+}
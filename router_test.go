@@ -577,6 +577,18 @@ func TestRouter_FindRouteStatic(t *testing.T) {
 			fullPath:   "/user/home/no",
 			wantedNode: nil,
 		},
+		{
+			caseName:   "trailing slash is not canonical /user/",
+			method:     http.MethodGet,
+			fullPath:   "/user/",
+			wantedNode: nil,
+		},
+		{
+			caseName:   "continuous slash is not canonical /user//home",
+			method:     http.MethodGet,
+			fullPath:   "/user//home",
+			wantedNode: nil,
+		},
 		{
 			caseName: "find root",
 			method:   http.MethodPost,
@@ -686,9 +698,13 @@ func TestRouter_FindRouteWildcard(t *testing.T) {
 			},
 		},
 		{
-			caseName: "find non-exist /user/somebody/homo",
+			caseName: "non-exist /user/somebody/homo falls back to /*",
 			method:   http.MethodGet,
 			fullPath: "/user/somebody/homo",
+			wantedNode: &node{
+				path:    "*",
+				handler: mockHandler,
+			},
 		},
 		{
 			caseName: "a node has no child but a wildcardChild",
@@ -740,10 +756,19 @@ func TestRouter_FindRouteWildcard(t *testing.T) {
 			},
 		},
 		{
-			caseName:   "more specific route but not match '/a/*/b",
-			method:     http.MethodPut,
-			fullPath:   "/a/whatever/b/c",
-			wantedNode: nil, // do not fallback to "/a/*"
+			caseName: "more specific route but not match '/a/*/b', fallback to '/a/*'",
+			method:   http.MethodPut,
+			fullPath: "/a/whatever/b/c",
+			wantedNode: &node{
+				path:    "*",
+				handler: mockHandler,
+				children: map[string]*node{
+					"b": &node{
+						path:    "b",
+						handler: mockHandler,
+					},
+				},
+			},
 		},
 		{
 			caseName: "not trilling wildcard1",
@@ -899,6 +924,49 @@ func TestRouter_FindRouteRegexp(t *testing.T) {
 	}
 }
 
+// Test: params of a trailing wildcard
+func TestRouter_FindRouteWildcardParam(t *testing.T) {
+	var mockHandler = func(ctx *Context) {}
+	r := newRouter()
+	r.AddRoute(http.MethodGet, "/a/*", mockHandler)
+	r.AddRoute(http.MethodGet, "/b/*/c", mockHandler)
+
+	testCases := []struct {
+		caseName   string
+		fullPath   string
+		wantParams param
+	}{
+		{
+			caseName:   "trailing wildcard pairs one sub-path",
+			fullPath:   "/a/b",
+			wantParams: param{"*": "b"},
+		},
+		{
+			caseName:   "trailing wildcard pairs anything left",
+			fullPath:   "/a/b/c/d/",
+			wantParams: param{"*": "b/c/d/"},
+		},
+		{
+			caseName:   "trailing wildcard pairs nothing after trailing slash",
+			fullPath:   "/a/",
+			wantParams: param{"*": ""},
+		},
+		{
+			caseName:   "not a trailing wildcard",
+			fullPath:   "/b/x/c",
+			wantParams: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			foundNode, params := r.FindRoute(http.MethodGet, tc.fullPath)
+			assert.NotNil(t, foundNode)
+			assert.Equal(t, tc.wantParams, *params)
+		})
+	}
+}
+
 // Compare two routers.
 func (r *router) equal(other *router) (bool, error) {
 	// Compare each tree in the forest
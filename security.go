@@ -0,0 +1,116 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// cspNoncePlaceholder is replaced by the nonce of the request in ContentSecurityPolicy
+const cspNoncePlaceholder = "{nonce}"
+
+// SecurityHeadersConfig configures the security headers middleware, an empty field sends no header
+type SecurityHeadersConfig struct {
+	// HSTS is the Strict-Transport-Security header, e.g. "max-age=63072000; includeSubDomains".
+	// Browsers ignore it over plain HTTP.
+	HSTS string
+	// ContentTypeOptions is the X-Content-Type-Options header, "nosniff" is the only value
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header, e.g. "DENY" or "SAMEORIGIN"
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header, e.g. "strict-origin-when-cross-origin"
+	ReferrerPolicy string
+	// PermissionsPolicy is the Permissions-Policy header, e.g. "camera=(), microphone=()"
+	PermissionsPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy header. "{nonce}" in it is replaced by the nonce of the
+	// request, see Context.CSPNonce, e.g. "script-src 'nonce-{nonce}'".
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only, so that it is tried without enforcing
+	CSPReportOnly bool
+}
+
+// DefaultSecurityHeaders is a strict config for HTML pages, change the fields as needed
+func DefaultSecurityHeaders() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTS:                  "max-age=63072000; includeSubDomains",
+		ContentTypeOptions:    "nosniff",
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+		PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+		ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+	}
+}
+
+// securityHeaderKeys are the headers managed by SecurityHeaders
+var securityHeaderKeys = []string{
+	"Strict-Transport-Security",
+	"X-Content-Type-Options",
+	"X-Frame-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+}
+
+// SecurityHeaders sets the security headers of cfg before the handler runs.
+// The headers set by an outer SecurityHeaders are replaced, so that a route group can have its own config:
+//
+//	server.Use(SecurityHeaders(DefaultSecurityHeaders()))
+//	embed := DefaultSecurityHeaders()
+//	embed.FrameOptions = ""
+//	embed.ContentSecurityPolicy = "frame-ancestors https://partner.example.com"
+//	server.Group("/embed", SecurityHeaders(embed))
+func SecurityHeaders(cfg SecurityHeadersConfig) Middleware {
+	useNonce := strings.Contains(cfg.ContentSecurityPolicy, cspNoncePlaceholder)
+	cspKey := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspKey = "Content-Security-Policy-Report-Only"
+	}
+	values := map[string]string{
+		"Strict-Transport-Security": cfg.HSTS,
+		"X-Content-Type-Options":    cfg.ContentTypeOptions,
+		"X-Frame-Options":           cfg.FrameOptions,
+		"Referrer-Policy":           cfg.ReferrerPolicy,
+		"Permissions-Policy":        cfg.PermissionsPolicy,
+		cspKey:                      cfg.ContentSecurityPolicy,
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			header := ctx.Resp.Header()
+			for _, key := range securityHeaderKeys {
+				header.Del(key)
+			}
+			for key, value := range values {
+				if value == "" {
+					continue
+				}
+				if key == cspKey && useNonce {
+					value = strings.ReplaceAll(value, cspNoncePlaceholder, ctx.newCSPNonce())
+				}
+				header.Set(key, value)
+			}
+			next(ctx)
+		}
+	}
+}
+
+// CSPNonce gets the nonce of the Content-Security-Policy set by SecurityHeaders, to be put on inline scripts
+// and styles, e.g. pass it to the template data and render <script nonce="{{ .Nonce }}">.
+// Empty if no policy of SecurityHeaders has "{nonce}".
+func (c *Context) CSPNonce() string {
+	return c.cspNonce
+}
+
+// newCSPNonce generates the nonce of the request once, so that nested SecurityHeaders agree on it
+func (c *Context) newCSPNonce() string {
+	if c.cspNonce == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			// crypto/rand never fails on supported platforms
+			panic(err)
+		}
+		c.cspNonce = base64.StdEncoding.EncodeToString(b)
+	}
+	return c.cspNonce
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: security headers with nonces, overridden by a group
+func TestSecurityHeaders(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(SecurityHeaders(DefaultSecurityHeaders())))
+	var nonce string
+	h.Get("/page", func(ctx *Context) {
+		nonce = ctx.CSPNonce()
+	})
+	embed := DefaultSecurityHeaders()
+	embed.FrameOptions = ""
+	embed.ContentSecurityPolicy = "frame-ancestors https://partner.example.com"
+	embed.CSPReportOnly = true
+	h.Group("/embed", SecurityHeaders(embed)).Get("/widget", func(ctx *Context) {
+		nonce = ctx.CSPNonce()
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/page", nil))
+	require.NotEmpty(t, nonce)
+	assert.Equal(t, http.Header{
+		"Strict-Transport-Security": {"max-age=63072000; includeSubDomains"},
+		"X-Content-Type-Options":    {"nosniff"},
+		"X-Frame-Options":           {"DENY"},
+		"Referrer-Policy":           {"strict-origin-when-cross-origin"},
+		"Permissions-Policy":        {"camera=(), microphone=(), geolocation=()"},
+		"Content-Security-Policy": {"default-src 'self'; script-src 'self' 'nonce-" + nonce +
+			"'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'"},
+	}, recorder.Header())
+
+	// a new nonce for every request
+	firstNonce := nonce
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/page", nil))
+	assert.NotEqual(t, firstNonce, nonce)
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/embed/widget", nil))
+	assert.Equal(t, http.Header{
+		"Strict-Transport-Security":           {"max-age=63072000; includeSubDomains"},
+		"X-Content-Type-Options":              {"nosniff"},
+		"Referrer-Policy":                     {"strict-origin-when-cross-origin"},
+		"Permissions-Policy":                  {"camera=(), microphone=(), geolocation=()"},
+		"Content-Security-Policy-Report-Only": {"frame-ancestors https://partner.example.com"},
+	}, recorder.Header())
+	// the outer nonce is kept even if the policy of the group does not use it
+	assert.NotEmpty(t, nonce)
+}
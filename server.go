@@ -3,6 +3,10 @@ package web
 import (
 	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
 )
 
 // Ensure HTTPServer implements Server
@@ -16,38 +20,243 @@ type param map[string]string
 type Server interface {
 	http.Handler
 	Start(addr string) error
-	AddRoute(method string, path string, handleFunc HandleFunc)
+	AddRoute(method string, path string, handleFunc HandleFunc, opts ...RouteOption)
 }
 
 // HTTPServer is a server handling  HTTP request
 type HTTPServer struct {
 	*router
+	hosts     []*HostRoutes // route tables of hosts, see Host
+	mdls      []Middleware
+	tplEngine TemplateEngine
+	// keys of signed and encrypted cookies, see ServerWithCookieKeys
+	cookieKeys *cookieKeyRing
+	// responds the errors of Context.Error, see ServerWithErrorHandler
+	errorHandler ErrorHandler
+
+	// Path policies, applied when the requested path does not match any route
+	redirectTrailingSlash bool // "/user/" --> "/user"
+	redirectCleanPath     bool // "/user//./home" --> "/user/home"
+	caseInsensitive       bool // "/USER/Home" --> "/user/home"
 }
 
+// HTTPServerOption configures an HTTPServer
+type HTTPServerOption func(server *HTTPServer)
+
 // NewHTTPServer constructs a http server
-func NewHTTPServer() *HTTPServer {
-	return &HTTPServer{
-		router: newRouter(),
+func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
+	h := &HTTPServer{
+		router:                newRouter(),
+		redirectTrailingSlash: true,
+		redirectCleanPath:     true,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServerWithMiddleware adds middlewares to the server, see HTTPServer.Use
+func ServerWithMiddleware(mdls ...Middleware) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.mdls = append(server.mdls, mdls...)
+	}
+}
+
+// ServerWithRedirectTrailingSlash sets whether a path with trailing '/' is redirected to the route without it.
+// Enabled by default.
+func ServerWithRedirectTrailingSlash(enabled bool) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectTrailingSlash = enabled
+	}
+}
+
+// ServerWithRedirectCleanPath sets whether a path with continuous '/', "." or ".." segments is redirected
+// to its cleaned form. Enabled by default.
+func ServerWithRedirectCleanPath(enabled bool) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectCleanPath = enabled
+	}
+}
+
+// ServerWithCaseInsensitive sets whether a path matching a route case-insensitively is redirected
+// to the registered casing. Disabled by default.
+func ServerWithCaseInsensitive(enabled bool) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.caseInsensitive = enabled
+	}
+}
+
+// ServerWithUseRawPath sets whether routes are matched against URL.EscapedPath() instead of the decoded
+// URL.Path. Param values are unescaped after matching, so that a value containing "%2F" is kept in one
+// sub-path, e.g. "/object/a%2Fb.txt" matches "/object/:key" with key "a/b.txt". Disabled by default.
+func ServerWithUseRawPath(enabled bool) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.router.useRawPath = enabled
 	}
 }
 
 type HTTPSServer struct {
 }
 
-// ServeHTTP serves an HTTP request: parses route and executes handler
+// Use adds middlewares to the server. They run for every request, including the unmatched ones.
+func (h *HTTPServer) Use(mdls ...Middleware) {
+	h.mdls = append(h.mdls, mdls...)
+}
+
+// ServeHTTP serves an HTTP request: runs middlewares, parses route and executes handler
 func (h *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	ctx := &Context{
-		Req:  request,
-		Resp: writer,
+		Req:    request,
+		Resp:   writer,
+		server: h,
+	}
+
+	root := h.serve
+	for i := len(h.mdls) - 1; i >= 0; i-- {
+		root = h.mdls[i](root)
 	}
+	root(ctx)
+}
 
-	routeNode, pathParam := h.router.FindRoute(ctx.Req.Method, ctx.Req.URL.Path)
-	if routeNode == nil || routeNode.handler == nil {
+// serve parses route and executes handler
+func (h *HTTPServer) serve(ctx *Context) {
+	r, hostParam := h.findHost(ctx.Req.Host)
+	reqPath := ctx.Req.URL.Path
+	if r.useRawPath {
+		reqPath = ctx.Req.URL.EscapedPath()
+	}
+	routeNode, pathParam := r.FindRoute(ctx.Req.Method, reqPath)
+	if routeNode == nil || !routeNode.routable() {
+		if h.redirectPath(ctx, r) {
+			return
+		}
+		// Mounted handlers take the methods without a route, after the path policies
+		routeNode, pathParam = r.FindRoute(anyMethod, reqPath)
+	}
+	if routeNode == nil || !routeNode.routable() {
 		http.NotFound(ctx.Resp, ctx.Req)
 		return
 	}
+	handler, code := routeNode.pickHandler(ctx.Req)
+	if handler == nil {
+		http.Error(ctx.Resp, http.StatusText(code), code)
+		return
+	}
+	// host params go along with path params
+	if pathParam == nil {
+		pathParam = new(param)
+	}
+	for key, value := range hostParam {
+		if *pathParam == nil {
+			*pathParam = make(param)
+		}
+		(*pathParam)[key] = value
+	}
 	ctx.Param = pathParam
-	routeNode.handler(ctx)
+	handler(ctx)
+}
+
+// URLFor builds the path of the named route, see RouteName and router.URLFor.
+// Routes of the default route table are looked up first, then the ones of hosts.
+func (h *HTTPServer) URLFor(name string, params ...string) (string, error) {
+	if _, ok := h.router.names[name]; ok {
+		return h.router.URLFor(name, params...)
+	}
+	for _, hr := range h.hosts {
+		if _, ok := hr.names[name]; ok {
+			return hr.URLFor(name, params...)
+		}
+	}
+	return h.router.URLFor(name, params...)
+}
+
+// redirectPath redirects the request to the canonical form of its path if the path policies allow.
+// It reports whether the request has been redirected.
+func (h *HTTPServer) redirectPath(ctx *Context, r *router) bool {
+	method := ctx.Req.Method
+	if method == http.MethodConnect || ctx.Req.URL.Path == "/" {
+		return false
+	}
+
+	// Work on the escaped path, so that encoded slashes in params survive the redirection
+	reqPath := ctx.Req.URL.EscapedPath()
+	fixedPath := reqPath
+	if h.redirectTrailingSlash && len(fixedPath) > 1 && fixedPath[len(fixedPath)-1] == '/' {
+		fixedPath = strings.TrimRight(fixedPath, "/")
+		if fixedPath == "" {
+			fixedPath = "/"
+		}
+		if hasRoute(r, method, fixedPath) {
+			redirect(ctx, fixedPath)
+			return true
+		}
+	}
+	if h.redirectCleanPath {
+		fixedPath = cleanPath(fixedPath)
+		if fixedPath != reqPath && hasRoute(r, method, fixedPath) {
+			redirect(ctx, fixedPath)
+			return true
+		}
+	}
+	if h.caseInsensitive {
+		if casedPath, ok := r.findCaseInsensitivePath(method, fixedPath); ok && casedPath != reqPath {
+			redirect(ctx, casedPath)
+			return true
+		}
+	}
+	return false
+}
+
+// hasRoute reports whether the escaped path matches a route with handler in r
+func hasRoute(r *router, method, escapedPath string) bool {
+	p := escapedPath
+	if !r.useRawPath {
+		var err error
+		if p, err = url.PathUnescape(escapedPath); err != nil {
+			return false
+		}
+	}
+	routeNode, _ := r.FindRoute(method, p)
+	return routeNode != nil && routeNode.routable()
+}
+
+// allowedMethods lists the methods having a route for the path of req, sorted
+func (h *HTTPServer) allowedMethods(req *http.Request) []string {
+	r, _ := h.findHost(req.Host)
+	var methods []string
+	for method := range r.trees {
+		if method != anyMethod && hasRoute(r, method, req.URL.EscapedPath()) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// cleanPath removes continuous '/', "." and ".." segments, but keeps the trailing '/'
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// redirect permanently redirects to p, keeping the query.
+// GET and HEAD get 301, other methods get 308 so that the method and body are not changed by clients.
+func redirect(ctx *Context, p string) {
+	code := http.StatusPermanentRedirect
+	if ctx.Req.Method == http.MethodGet || ctx.Req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	if ctx.Req.URL.RawQuery != "" {
+		p += "?" + ctx.Req.URL.RawQuery
+	}
+	http.Redirect(ctx.Resp, ctx.Req, p, code)
 }
 
 // Start the HTTPServer
@@ -62,12 +271,17 @@ func (h *HTTPServer) Start(addr string) error {
 	return http.Serve(l, h)
 }
 
+// AddRoute adds a route, see router.AddRoute. The handler is not run if the body is over BodyLimit.
+func (h *HTTPServer) AddRoute(method string, path string, handleFunc HandleFunc, opts ...RouteOption) {
+	h.router.AddRoute(method, path, checkBodyLimit(handleFunc), opts...)
+}
+
 // Get request tool function
-func (h *HTTPServer) Get(path string, handler HandleFunc) {
-	h.AddRoute(http.MethodGet, path, handler)
+func (h *HTTPServer) Get(path string, handler HandleFunc, opts ...RouteOption) {
+	h.AddRoute(http.MethodGet, path, handler, opts...)
 }
 
 // Post request tool function
-func (h *HTTPServer) Post(path string, handler HandleFunc) {
-	h.AddRoute(http.MethodPost, path, handler)
+func (h *HTTPServer) Post(path string, handler HandleFunc, opts ...RouteOption) {
+	h.AddRoute(http.MethodPost, path, handler, opts...)
 }
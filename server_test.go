@@ -1,9 +1,186 @@
 package web
 
 import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestServer(t *testing.T) {
 
 }
+
+// Test: redirect to the canonical path according to path policies
+func TestHTTPServer_PathPolicy(t *testing.T) {
+	var mockHandler = func(ctx *Context) {
+		ctx.Resp.WriteHeader(http.StatusOK)
+	}
+
+	testCases := []struct {
+		caseName     string
+		opts         []HTTPServerOption
+		method       string
+		url          string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			caseName: "canonical path",
+			method:   http.MethodGet,
+			url:      "/user/home",
+			wantCode: http.StatusOK,
+		},
+		{
+			caseName:     "trailing slash",
+			method:       http.MethodGet,
+			url:          "/user/home/?a=b",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home?a=b",
+		},
+		{
+			caseName:     "trailing slash of POST keeps method",
+			method:       http.MethodPost,
+			url:          "/user/home/",
+			wantCode:     http.StatusPermanentRedirect,
+			wantLocation: "/user/home",
+		},
+		{
+			caseName: "trailing slash redirection disabled",
+			opts:     []HTTPServerOption{ServerWithRedirectTrailingSlash(false)},
+			method:   http.MethodGet,
+			url:      "/user/home/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName:     "continuous slashes and dots",
+			method:       http.MethodGet,
+			url:          "/user//./order/../home",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home",
+		},
+		{
+			caseName: "clean path redirection disabled",
+			opts:     []HTTPServerOption{ServerWithRedirectCleanPath(false)},
+			method:   http.MethodGet,
+			url:      "/user//home",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName: "case-insensitive disabled by default",
+			method:   http.MethodGet,
+			url:      "/USER/Home",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName:     "case-insensitive",
+			opts:         []HTTPServerOption{ServerWithCaseInsensitive(true)},
+			method:       http.MethodGet,
+			url:          "/USER//Home/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home",
+		},
+		{
+			// the decoded path has a sub-path more than the route
+			caseName: "case-insensitive splits encoded slash",
+			opts:     []HTTPServerOption{ServerWithCaseInsensitive(true)},
+			method:   http.MethodGet,
+			url:      "/File/a%2FB/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName:     "case-insensitive keeps param and encoded slash of raw path",
+			opts:         []HTTPServerOption{ServerWithCaseInsensitive(true), ServerWithUseRawPath(true)},
+			method:       http.MethodGet,
+			url:          "/File/a%2FB/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/file/a%2FB",
+		},
+		{
+			caseName:     "case-insensitive wildcard with encoded slash",
+			opts:         []HTTPServerOption{ServerWithCaseInsensitive(true)},
+			method:       http.MethodGet,
+			url:          "/Static/a%2FB",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/static/a/B",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			h := NewHTTPServer(tc.opts...)
+			h.Get("/user/home", mockHandler)
+			h.Post("/user/home", mockHandler)
+			h.Get("/file/:name", mockHandler)
+			h.Get("/static/*", mockHandler)
+
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+// Test: route on the escaped path, unescape param values after matching
+func TestHTTPServer_UseRawPath(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		opts     []HTTPServerOption
+		url      string
+		wantCode int
+		wantKey  string
+	}{
+		{
+			caseName: "decoded path splits encoded slash",
+			url:      "/object/a%2Fb.txt",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName: "raw path keeps encoded slash",
+			opts:     []HTTPServerOption{ServerWithUseRawPath(true)},
+			url:      "/object/a%2Fb.txt",
+			wantCode: http.StatusOK,
+			wantKey:  "a/b.txt",
+		},
+		{
+			caseName: "raw path unescapes other characters",
+			opts:     []HTTPServerOption{ServerWithUseRawPath(true)},
+			url:      "/object/john%40example.com",
+			wantCode: http.StatusOK,
+			wantKey:  "john@example.com",
+		},
+		{
+			caseName: "raw path matches escaped static sub-path",
+			opts:     []HTTPServerOption{ServerWithUseRawPath(true)},
+			url:      "/%6Fbject/a",
+			wantCode: http.StatusOK,
+			wantKey:  "a",
+		},
+		{
+			caseName: "raw path redirects trailing slash keeping encoded slash",
+			opts:     []HTTPServerOption{ServerWithUseRawPath(true)},
+			url:      "/object/a%2Fb.txt/",
+			wantCode: http.StatusMovedPermanently,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			h := NewHTTPServer(tc.opts...)
+			var key string
+			h.Get("/object/:key", func(ctx *Context) {
+				key = ctx.PathValue("key")
+			})
+
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantKey, key)
+			if tc.wantCode == http.StatusMovedPermanently {
+				assert.Equal(t, "/object/a%2Fb.txt", recorder.Header().Get("Location"))
+			}
+		})
+	}
+}
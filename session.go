@@ -0,0 +1,244 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrSessionNotFound is returned by Store when the session does not exist or has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is the data of a client kept across requests, see Sessions and Context.Session
+type Session interface {
+	// ID is the session id, empty before anything is set
+	ID() string
+	Get(key string) (any, bool)
+	Set(key string, value any)
+	Delete(key string)
+	// Regenerate changes the session id and keeps the data. Call it when the privilege changes, e.g. on login,
+	// so that a session id planted by an attacker becomes useless (session fixation).
+	Regenerate() error
+	// Destroy removes the session from the store and the client, e.g. on logout
+	Destroy() error
+}
+
+// Store keeps the data of sessions.
+// A token is what the client holds: for server-side stores it is the id, for CookieStore it is the data itself.
+type Store interface {
+	// Load loads the session of token, ErrSessionNotFound if it does not exist or has expired
+	Load(ctx context.Context, token string) (id string, data map[string]any, err error)
+	// Save saves the session for ttl, and returns the token for the client
+	Save(ctx context.Context, id string, data map[string]any, ttl time.Duration) (token string, err error)
+	// Delete deletes the session of id
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionConfig configures the session middleware
+type SessionConfig struct {
+	Store Store
+	// TTL is how long a session lives since the last request using it. Default is 24 hours.
+	TTL time.Duration
+	// CookieName is the cookie carrying the token. Default is "session_id".
+	CookieName string
+	// CookieOptions are applied to the session cookie, the secure defaults of Context.SetCookie are kept otherwise
+	CookieOptions []CookieOption
+	// Header carries the token instead of the cookie if set, e.g. "X-Session-Id" for API clients.
+	// The token is read from the request header and written to the response header.
+	Header string
+}
+
+// Sessions is the session middleware, the session of the request is available by Context.Session.
+// The session is saved right before the response is written, or after the handler if nothing is written.
+// A token unknown to the store is never adopted: a new session always gets a new id.
+func Sessions(cfg SessionConfig) Middleware {
+	if cfg.Store == nil {
+		panic("session store is nil")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "session_id"
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			s := &session{cfg: &cfg, ctx: ctx}
+			if token := s.token(); token != "" {
+				id, data, err := cfg.Store.Load(ctx.Req.Context(), token)
+				if err == nil {
+					s.id, s.data = id, data
+				}
+			}
+			ctx.session = s
+
+			// Save before the headers are sent
+			w := &hookedWriter{ResponseWriter: ctx.Resp, beforeWrite: s.commit}
+			ctx.Resp = w
+			next(ctx)
+			ctx.Resp = w.ResponseWriter
+			w.fire()
+		}
+	}
+}
+
+// Session gets the session of the request, nil without the Sessions middleware
+func (c *Context) Session() Session {
+	if c.session == nil {
+		return nil
+	}
+	return c.session
+}
+
+// session implements Session
+type session struct {
+	cfg       *SessionConfig
+	ctx       *Context
+	id        string
+	data      map[string]any
+	destroyed bool
+}
+
+func (s *session) ID() string {
+	return s.id
+}
+
+func (s *session) Get(key string) (any, bool) {
+	val, ok := s.data[key]
+	return val, ok
+}
+
+func (s *session) Set(key string, value any) {
+	s.start()
+	s.data[key] = value
+}
+
+func (s *session) Delete(key string) {
+	delete(s.data, key)
+}
+
+func (s *session) Regenerate() error {
+	if s.id != "" {
+		if err := s.cfg.Store.Delete(s.ctx.Req.Context(), s.id); err != nil {
+			return err
+		}
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	s.id = id
+	if s.data == nil {
+		s.data = make(map[string]any)
+	}
+	s.destroyed = false
+	return nil
+}
+
+func (s *session) Destroy() error {
+	if s.id != "" {
+		if err := s.cfg.Store.Delete(s.ctx.Req.Context(), s.id); err != nil {
+			return err
+		}
+	}
+	s.id, s.data, s.destroyed = "", nil, true
+	return nil
+}
+
+// start starts a new session if there is none
+func (s *session) start() {
+	if s.id != "" {
+		return
+	}
+	id, err := newSessionID()
+	if err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	s.id, s.data, s.destroyed = id, make(map[string]any), false
+}
+
+// token reads the token from the request
+func (s *session) token() string {
+	if s.cfg.Header != "" {
+		return s.ctx.Req.Header.Get(s.cfg.Header)
+	}
+	token, _ := s.ctx.Cookie(s.cfg.CookieName)
+	return token
+}
+
+// commit saves the session and sends the token to the client
+func (s *session) commit() {
+	header := s.ctx.Resp.Header()
+	if s.destroyed {
+		if s.cfg.Header != "" {
+			header.Del(s.cfg.Header)
+		} else {
+			s.ctx.DeleteCookie(s.cfg.CookieName, s.cfg.CookieOptions...)
+		}
+		return
+	}
+	if s.id == "" {
+		return
+	}
+
+	token, err := s.cfg.Store.Save(s.ctx.Req.Context(), s.id, s.data, s.cfg.TTL)
+	if err != nil {
+		// Too late to respond the error, the client keeps the old token if any
+		return
+	}
+	if s.cfg.Header != "" {
+		header.Set(s.cfg.Header, token)
+		return
+	}
+	s.ctx.SetCookie(s.cfg.CookieName, token, append([]CookieOption{CookieWithMaxAge(s.cfg.TTL)}, s.cfg.CookieOptions...)...)
+}
+
+// newSessionID generates a random id of 256 bits
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hookedWriter calls beforeWrite once right before the headers are sent
+type hookedWriter struct {
+	http.ResponseWriter
+	beforeWrite func()
+	fired       bool
+}
+
+func (w *hookedWriter) fire() {
+	if !w.fired {
+		w.fired = true
+		w.beforeWrite()
+	}
+}
+
+func (w *hookedWriter) WriteHeader(code int) {
+	w.fire()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hookedWriter) Write(b []byte) (int, error) {
+	w.fire()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hookedWriter) Flush() {
+	w.fire()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController
+func (w *hookedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
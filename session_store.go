@@ -0,0 +1,223 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore removes the expired sessions
+const sweepInterval = time.Minute
+
+// MemoryStore keeps sessions in memory, they are lost when the process exits
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	nextSweep time.Time
+}
+
+type memorySession struct {
+	data      map[string]any
+	expiresAt time.Time
+}
+
+// NewMemoryStore constructs a MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]memorySession),
+	}
+}
+
+// Load loads the session of id
+func (m *MemoryStore) Load(ctx context.Context, id string) (string, map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return "", nil, ErrSessionNotFound
+	}
+	if time.Now().After(s.expiresAt) {
+		delete(m.sessions, id)
+		return "", nil, ErrSessionNotFound
+	}
+	return id, copyData(s.data), nil
+}
+
+// Save saves the session, the token is the id
+func (m *MemoryStore) Save(ctx context.Context, id string, data map[string]any, ttl time.Duration) (string, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[id] = memorySession{data: copyData(data), expiresAt: now.Add(ttl)}
+
+	// Sweep expired sessions lazily instead of running a goroutine
+	if now.After(m.nextSweep) {
+		for sid, s := range m.sessions {
+			if now.After(s.expiresAt) {
+				delete(m.sessions, sid)
+			}
+		}
+		m.nextSweep = now.Add(sweepInterval)
+	}
+	return id, nil
+}
+
+// Delete deletes the session of id
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// copyData makes a shallow copy, so that requests do not share the map
+func copyData(data map[string]any) map[string]any {
+	res := make(map[string]any, len(data))
+	for key, value := range data {
+		res[key] = value
+	}
+	return res
+}
+
+// FileStore keeps sessions in files of a directory, one file per session.
+// The data is encoded as JSON, so values are loaded as JSON types, e.g. numbers as float64.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore constructs a FileStore keeping sessions in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+type storedSession struct {
+	ID        string         `json:"id"`
+	Data      map[string]any `json:"data"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// Load loads the session of id
+func (f *FileStore) Load(ctx context.Context, id string) (string, map[string]any, error) {
+	path, ok := f.path(id)
+	if !ok {
+		return "", nil, ErrSessionNotFound
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var s storedSession
+	if err = json.Unmarshal(content, &s); err != nil {
+		return "", nil, err
+	}
+	if time.Now().After(s.ExpiresAt) {
+		os.Remove(path)
+		return "", nil, ErrSessionNotFound
+	}
+	return id, s.Data, nil
+}
+
+// Save saves the session atomically, the token is the id
+func (f *FileStore) Save(ctx context.Context, id string, data map[string]any, ttl time.Duration) (string, error) {
+	path, ok := f.path(id)
+	if !ok {
+		return "", errors.New("invalid session id")
+	}
+	content, err := json.Marshal(storedSession{ID: id, Data: data, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	if err = SaveUpload(bytes.NewReader(content), path); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Delete deletes the session of id
+func (f *FileStore) Delete(ctx context.Context, id string) error {
+	path, ok := f.path(id)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path gets the file of session id. The id comes from the client, only base64url characters are allowed,
+// so that it can never point out of the directory.
+func (f *FileStore) path(id string) (string, bool) {
+	if id == "" {
+		return "", false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", false
+		}
+	}
+	return filepath.Join(f.dir, id+".json"), true
+}
+
+// maxCookieTokenLen is the max length of a CookieStore token, cookies over 4096 bytes are dropped by browsers
+const maxCookieTokenLen = 4000
+
+// CookieStore keeps sessions in the client, encrypted by AES-GCM, nothing is kept on the server.
+// The data is encoded as JSON and the whole session must fit in a cookie.
+// Delete cannot revoke a copy of the cookie kept by the client, it expires by its TTL only.
+type CookieStore struct {
+	keys *cookieKeyRing
+}
+
+// NewCookieStore constructs a CookieStore, secrets are the same as ServerWithCookieKeys
+func NewCookieStore(secrets ...[]byte) *CookieStore {
+	return &CookieStore{keys: newCookieKeyRing(secrets)}
+}
+
+// Load decrypts the session from token
+func (cs *CookieStore) Load(ctx context.Context, token string) (string, map[string]any, error) {
+	content, err := cs.keys.decrypt("session", token)
+	if err != nil {
+		return "", nil, ErrSessionNotFound
+	}
+	var s storedSession
+	if err = json.Unmarshal([]byte(content), &s); err != nil {
+		return "", nil, ErrSessionNotFound
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return "", nil, ErrSessionNotFound
+	}
+	return s.ID, s.Data, nil
+}
+
+// Save encrypts the session to the token
+func (cs *CookieStore) Save(ctx context.Context, id string, data map[string]any, ttl time.Duration) (string, error) {
+	content, err := json.Marshal(storedSession{ID: id, Data: data, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	token, err := cs.keys.encrypt("session", string(content))
+	if err != nil {
+		return "", err
+	}
+	if len(token) > maxCookieTokenLen {
+		return "", errors.New("session is too large for a cookie")
+	}
+	return token, nil
+}
+
+// Delete does nothing, the cookie is deleted by the session middleware
+func (cs *CookieStore) Delete(ctx context.Context, id string) error {
+	return nil
+}
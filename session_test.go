@@ -0,0 +1,171 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newSessionServer makes a server with login, profile and logout routes
+func newSessionServer(cfg SessionConfig) *HTTPServer {
+	h := NewHTTPServer(ServerWithMiddleware(Sessions(cfg)))
+	h.Get("/visit", func(ctx *Context) {
+		ctx.Session().Set("visited", true)
+	})
+	h.Post("/login", func(ctx *Context) {
+		sess := ctx.Session()
+		if err := sess.Regenerate(); err != nil {
+			ctx.Resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sess.Set("user", "tom")
+		ctx.Resp.Write([]byte("welcome"))
+	})
+	h.Get("/profile", func(ctx *Context) {
+		user, ok := ctx.Session().Get("user")
+		if !ok {
+			ctx.Resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, visited := ctx.Session().Get("visited")
+		ctx.Resp.Write([]byte(user.(string)))
+		if visited {
+			ctx.Resp.Write([]byte(" visited"))
+		}
+	})
+	h.Post("/logout", func(ctx *Context) {
+		ctx.Session().Destroy()
+	})
+	return h
+}
+
+// sessionCookie finds the session cookie set by the response
+func sessionCookie(recorder *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == "session_id" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// Test: login, use and logout with stores
+func TestSessions(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+		"cookie": NewCookieStore(oldCookieSecret),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			h := newSessionServer(SessionConfig{Store: store, CookieOptions: []CookieOption{CookieInsecure()}})
+			do := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, nil)
+				if cookie != nil {
+					req.AddCookie(cookie)
+				}
+				recorder := httptest.NewRecorder()
+				h.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			// no session is started until something is set
+			recorder := do(http.MethodGet, "/profile", nil)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+			assert.Nil(t, sessionCookie(recorder))
+
+			// an anonymous session
+			recorder = do(http.MethodGet, "/visit", nil)
+			anonymous := sessionCookie(recorder)
+			require.NotNil(t, anonymous)
+			assert.True(t, anonymous.HttpOnly)
+			assert.Equal(t, 86400, anonymous.MaxAge)
+
+			// login regenerates the id and keeps the data
+			recorder = do(http.MethodPost, "/login", anonymous)
+			assert.Equal(t, "welcome", recorder.Body.String())
+			loggedIn := sessionCookie(recorder)
+			require.NotNil(t, loggedIn)
+			assert.NotEqual(t, anonymous.Value, loggedIn.Value)
+
+			recorder = do(http.MethodGet, "/profile", loggedIn)
+			assert.Equal(t, "tom visited", recorder.Body.String())
+
+			// logout deletes the cookie
+			recorder = do(http.MethodPost, "/logout", loggedIn)
+			deleted := sessionCookie(recorder)
+			require.NotNil(t, deleted)
+			assert.Equal(t, "", deleted.Value)
+			assert.Equal(t, -1, deleted.MaxAge)
+
+			if name == "cookie" {
+				// the client side copy cannot be revoked
+				return
+			}
+			// the old ids are useless
+			assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/profile", loggedIn).Code)
+			recorder = do(http.MethodGet, "/profile", anonymous)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+	}
+}
+
+// Test: the token is carried by header
+func TestSessions_Header(t *testing.T) {
+	h := newSessionServer(SessionConfig{Store: NewMemoryStore(), Header: "X-Session-Id"})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/login", nil))
+	token := recorder.Header().Get("X-Session-Id")
+	require.NotEmpty(t, token)
+	assert.Empty(t, recorder.Result().Cookies())
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set("X-Session-Id", token)
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, "tom", recorder.Body.String())
+}
+
+// Test: a token planted by an attacker is not adopted
+func TestSessions_Fixation(t *testing.T) {
+	h := newSessionServer(SessionConfig{Store: NewMemoryStore()})
+	req := httptest.NewRequest(http.MethodGet, "/visit", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "planted"})
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	cookie := sessionCookie(recorder)
+	require.NotNil(t, cookie)
+	assert.NotEqual(t, "planted", cookie.Value)
+}
+
+// Test: sessions expire by TTL
+func TestSessionStores_Expire(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	for _, store := range []Store{NewMemoryStore(), fileStore, NewCookieStore(oldCookieSecret)} {
+		ctx := context.Background()
+		token, err := store.Save(ctx, "id1", map[string]any{"a": "b"}, time.Hour)
+		require.NoError(t, err)
+		id, data, err := store.Load(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, "id1", id)
+		assert.Equal(t, map[string]any{"a": "b"}, data)
+
+		token, err = store.Save(ctx, "id2", map[string]any{"a": "b"}, -time.Second)
+		require.NoError(t, err)
+		_, _, err = store.Load(ctx, token)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	}
+
+	// ids from the client never point out of the directory
+	_, _, err = fileStore.Load(context.Background(), "../secret")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
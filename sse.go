@@ -0,0 +1,160 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEWriter writes Server-Sent Events, see Context.SSE
+type SSEWriter struct {
+	ctx       *Context
+	rc        *http.ResponseController
+	mu        sync.Mutex // events and heartbeats are written by different goroutines
+	done      <-chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// SSEOption configures an SSEWriter
+type SSEOption func(s *sseConfig)
+
+type sseConfig struct {
+	heartbeat time.Duration
+}
+
+// SSEWithHeartbeat writes a comment every interval, so that proxies do not close an idle connection
+func SSEWithHeartbeat(interval time.Duration) SSEOption {
+	return func(cfg *sseConfig) {
+		cfg.heartbeat = interval
+	}
+}
+
+// SSE starts a Server-Sent Events response. Every write is flushed at once, and the response is marked not to
+// be buffered by proxies. Response writers of this package that buffer switch to pass-through on flush, so
+// events are not held back by middlewares either.
+// Call Close when done, the handler must not return before that:
+//
+//	sse, err := ctx.SSE(SSEWithHeartbeat(15 * time.Second))
+//	if err != nil {
+//		return
+//	}
+//	defer sse.Close()
+//	for job := range updates {
+//		if sse.Send("status", job.ID, job.Status) != nil {
+//			return // the client is gone
+//		}
+//	}
+func (c *Context) SSE(opts ...SSEOption) (*SSEWriter, error) {
+	cfg := &sseConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	header := c.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// nginx buffers responses unless told not to
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Length")
+
+	s := &SSEWriter{
+		ctx:    c,
+		rc:     http.NewResponseController(c.Resp),
+		done:   c.Req.Context().Done(),
+		closed: make(chan struct{}),
+	}
+	c.Resp.WriteHeader(http.StatusOK)
+	if err := s.rc.Flush(); err != nil {
+		return nil, err
+	}
+	if cfg.heartbeat > 0 {
+		go s.heartbeat(cfg.heartbeat)
+	}
+	return s, nil
+}
+
+// LastEventID is the id of the last event the client has received before reconnecting, empty for a new client
+func (s *SSEWriter) LastEventID() string {
+	return s.ctx.Req.Header.Get("Last-Event-ID")
+}
+
+// Done is closed when the client is gone
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send sends an event. event and id are optional, a multi-line data is sent as multiple "data" fields.
+func (s *SSEWriter) Send(event, id, data string) error {
+	var sb strings.Builder
+	if event != "" {
+		sb.WriteString("event: " + sseField(event) + "\n")
+	}
+	if id != "" {
+		sb.WriteString("id: " + sseField(id) + "\n")
+	}
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+// Retry tells the client how long to wait before reconnecting
+func (s *SSEWriter) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Close stops the heartbeat. Nothing can be sent after that.
+func (s *SSEWriter) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		close(s.closed)
+		s.mu.Unlock()
+	})
+}
+
+// write writes and flushes, unless the client is gone or the writer is closed
+func (s *SSEWriter) write(content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closed:
+		return errors.New("sse writer is closed")
+	case <-s.done:
+		return s.ctx.Req.Context().Err()
+	default:
+	}
+	if _, err := s.ctx.Resp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *SSEWriter) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// a comment line is ignored by clients
+			if s.write(": heartbeat\n\n") != nil {
+				return
+			}
+		case <-s.done:
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// sseField removes line breaks, which would end the field
+func sseField(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
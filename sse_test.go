@@ -0,0 +1,92 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test: send events, retry hints and resume by Last-Event-ID
+func TestContext_SSE(t *testing.T) {
+	h := NewHTTPServer()
+	h.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE()
+		require.NoError(t, err)
+		defer sse.Close()
+
+		require.NoError(t, sse.Retry(3*time.Second))
+		start := 0
+		if sse.LastEventID() == "1" {
+			start = 2
+		}
+		events := []string{"queued", "running\nstep 1", "done"}
+		for i := start; i < len(events); i++ {
+			require.NoError(t, sse.Send("status", strings.Repeat("1", i), events[i]))
+		}
+		require.NoError(t, sse.Send("", "", "bye"))
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "no", recorder.Header().Get("X-Accel-Buffering"))
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "retry: 3000\n\n"+
+		"event: status\ndata: queued\n\n"+
+		"event: status\nid: 1\ndata: running\ndata: step 1\n\n"+
+		"event: status\nid: 11\ndata: done\n\n"+
+		"data: bye\n\n", recorder.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, "retry: 3000\n\nevent: status\nid: 11\ndata: done\n\ndata: bye\n\n", recorder.Body.String())
+}
+
+// lockedRecorder is a ResponseRecorder safe to read while the heartbeat is writing
+type lockedRecorder struct {
+	*httptest.ResponseRecorder
+	mu sync.Mutex
+}
+
+func (r *lockedRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *lockedRecorder) body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Body.String()
+}
+
+// Test: heartbeats, and stop on client disconnect
+func TestContext_SSEHeartbeat(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	h := NewHTTPServer()
+	var sendErr error
+	h.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE(SSEWithHeartbeat(time.Millisecond))
+		require.NoError(t, err)
+		defer sse.Close()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-sse.Done()
+		sendErr = sse.Send("", "", "too late")
+	})
+
+	recorder := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(reqCtx))
+	assert.ErrorIs(t, sendErr, context.Canceled)
+	body := recorder.body()
+	assert.Contains(t, body, ": heartbeat\n\n")
+	assert.NotContains(t, body, "too late")
+}
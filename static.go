@@ -0,0 +1,343 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// precompressedEncodings are the encodings of precompressed siblings, in order of preference
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{encoding: "br", ext: ".br"},
+	{encoding: "gzip", ext: ".gz"},
+}
+
+// staticHandler serves files of a fs.FS
+type staticHandler struct {
+	fsys          fs.FS
+	index         string            // file served for a directory
+	listDirs      bool              // list the directory without index file
+	spaEntry      string            // file served for unknown paths of HTML navigation requests
+	cacheControls map[string]string // extension --> Cache-Control, "" for the others
+	hashes        sync.Map          // name and size --> ETag of the files without modification time
+}
+
+// StaticOption configures the static file serving
+type StaticOption func(s *staticHandler)
+
+// StaticWithIndex sets the file served for a directory. Default is "index.html".
+func StaticWithIndex(name string) StaticOption {
+	return func(s *staticHandler) {
+		s.index = name
+	}
+}
+
+// StaticWithDirectoryListing lists the directories without index file. Disabled by default.
+func StaticWithDirectoryListing() StaticOption {
+	return func(s *staticHandler) {
+		s.listDirs = true
+	}
+}
+
+// StaticWithSPA enables the single-page-app mode: for HTML navigation requests, i.e. GET or HEAD accepting
+// "text/html", an unknown path is served with the entry file, e.g. "index.html", so that the client-side
+// router can handle it. Other requests of unknown paths, e.g. a missing script or image, still get 404.
+func StaticWithSPA(entry string) StaticOption {
+	return func(s *staticHandler) {
+		s.spaEntry = entry
+	}
+}
+
+// StaticWithCacheControl sets the Cache-Control header of files with extensions, e.g.
+//
+//	StaticWithCacheControl("public, max-age=31536000, immutable", ".js", ".css")
+//	StaticWithCacheControl("no-cache", ".html")
+//
+// Without extensions, it is the default of all the other files.
+func StaticWithCacheControl(value string, exts ...string) StaticOption {
+	return func(s *staticHandler) {
+		if len(exts) == 0 {
+			s.cacheControls[""] = value
+			return
+		}
+		for _, ext := range exts {
+			s.cacheControls[strings.ToLower(ext)] = value
+		}
+	}
+}
+
+// Static serves files of fsys under prefix, e.g. Static("/assets", os.DirFS("./public")) or with an embed.FS.
+// Files are served by GET and HEAD with ETag, Last-Modified and Range support. If the client accepts,
+// a precompressed sibling "name.br" or "name.gz" is served instead of "name".
+func (h *HTTPServer) Static(prefix string, fsys fs.FS, opts ...StaticOption) {
+	s := &staticHandler{
+		fsys:          fsys,
+		index:         "index.html",
+		cacheControls: map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	wildcardPath := prefix + "/*"
+	if prefix == "/" {
+		wildcardPath = "/*"
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		h.AddRoute(method, prefix, s.serve)
+		h.AddRoute(method, wildcardPath, s.serve)
+	}
+}
+
+// serve serves the file paired by the trailing wildcard
+func (s *staticHandler) serve(ctx *Context) {
+	name, ok := fsName(ctx.PathValue(wildcardParamKey))
+	if !ok {
+		http.NotFound(ctx.Resp, ctx.Req)
+		return
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && s.serveSPAEntry(ctx) {
+			return
+		}
+		fsError(ctx, err)
+		return
+	}
+
+	if info.IsDir() {
+		// Redirect "/dir" to "/dir/", so that relative links in the index file work
+		if !strings.HasSuffix(ctx.Req.URL.Path, "/") {
+			redirect(ctx, ctx.Req.URL.EscapedPath()+"/")
+			return
+		}
+		indexName := path.Join(name, s.index)
+		indexInfo, err := fs.Stat(s.fsys, indexName)
+		if err != nil || indexInfo.IsDir() {
+			if s.listDirs {
+				s.listDir(ctx, name)
+				return
+			}
+			if s.serveSPAEntry(ctx) {
+				return
+			}
+			http.NotFound(ctx.Resp, ctx.Req)
+			return
+		}
+		name, info = indexName, indexInfo
+	}
+	s.serveFile(ctx, name, info)
+}
+
+// serveSPAEntry serves the entry file of SPA mode for HTML navigation requests.
+// It reports whether the entry file has been served.
+func (s *staticHandler) serveSPAEntry(ctx *Context) bool {
+	if s.spaEntry == "" || !isHTMLNavigation(ctx.Req) {
+		return false
+	}
+	info, err := fs.Stat(s.fsys, s.spaEntry)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	s.serveFile(ctx, s.spaEntry, info)
+	return true
+}
+
+// isHTMLNavigation reports whether req is a browser navigation, judged by the Accept header.
+// Only an explicit "text/html" counts, "*/*" is sent for scripts, images and API calls too.
+func isHTMLNavigation(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return parseQValues(req.Header.Get("Accept"))["text/html"] > 0
+}
+
+// serveFile serves a regular file, or its precompressed sibling
+func (s *staticHandler) serveFile(ctx *Context, name string, info fs.FileInfo) {
+	header := ctx.Resp.Header()
+	if cacheControl, ok := s.cacheControls[strings.ToLower(path.Ext(name))]; ok {
+		header.Set("Cache-Control", cacheControl)
+	} else if cacheControl, ok = s.cacheControls[""]; ok {
+		header.Set("Cache-Control", cacheControl)
+	}
+
+	servedName, servedInfo := name, info
+	header.Add("Vary", "Accept-Encoding")
+	if encoding, encodedName, encodedInfo, ok := s.precompressed(ctx.Req, name); ok {
+		servedName, servedInfo = encodedName, encodedInfo
+		header.Set("Content-Encoding", encoding)
+		// The type is of the original file. Do not let http.ServeContent sniff the compressed content.
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+	}
+
+	f, err := s.fsys.Open(servedName)
+	if err != nil {
+		fsError(ctx, err)
+		return
+	}
+	defer f.Close()
+	// http.ServeContent needs to seek for Range requests. Files of os.DirFS and embed.FS can seek.
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(ctx.Resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := s.etag(servedName, servedInfo, content)
+	if err != nil {
+		http.Error(ctx.Resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	header.Set("ETag", etag)
+	// ServeContent handles If-None-Match, If-Modified-Since, Range and If-Range
+	http.ServeContent(ctx.Resp, ctx.Req, name, servedInfo.ModTime(), content)
+}
+
+// precompressed finds a precompressed sibling of name accepted by req
+func (s *staticHandler) precompressed(req *http.Request, name string) (string, string, fs.FileInfo, bool) {
+	acceptEncoding := req.Header.Get("Accept-Encoding")
+	if acceptEncoding == "" {
+		return "", "", nil, false
+	}
+	qValues := parseQValues(acceptEncoding)
+	bestQ := 0.0
+	var bestEncoding, bestName string
+	var bestInfo fs.FileInfo
+	for _, pc := range precompressedEncodings {
+		q := qValueOf(qValues, pc.encoding)
+		if q <= bestQ {
+			continue
+		}
+		info, err := fs.Stat(s.fsys, name+pc.ext)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		bestQ, bestEncoding, bestName, bestInfo = q, pc.encoding, name+pc.ext, info
+	}
+	return bestEncoding, bestName, bestInfo, bestInfo != nil
+}
+
+// listDir writes a simple HTML page listing the entries of directory name
+func (s *staticHandler) listDir(ctx *Context, name string) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		fsError(ctx, err)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		// url.URL escapes the name as a path, e.g. "a b" --> "a%20b"
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(entryName))
+	}
+	buf.WriteString("</pre>\n")
+	ctx.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Resp.Write(buf.Bytes())
+}
+
+// fsName converts the path paired by the trailing wildcard to a name of fs.FS.
+// ".." can never go above the root, e.g. "../../etc/passwd" --> "etc/passwd".
+func fsName(p string) (string, bool) {
+	name := path.Clean("/" + p)[1:]
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name) && !strings.Contains(name, "\\")
+}
+
+// fsError responds the error of fs.FS with a proper status code, without exposing the details
+func fsError(ctx *Context, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(ctx.Resp, ctx.Req)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(ctx.Resp, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(ctx.Resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// etag makes the ETag of a file. A file without modification time, e.g. of embed.FS, gets the hash of its content,
+// computed once, as its size alone does not tell a new version.
+func (s *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fileETag(info), nil
+	}
+	key := name + "\x00" + strconv.FormatInt(info.Size(), 10)
+	if etag, ok := s.hashes.Load(key); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf("\"%x\"", hash.Sum(nil)[:16])
+	s.hashes.Store(key, etag)
+	return etag, nil
+}
+
+// fileETag makes a strong ETag of a file from its modification time and size
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
+
+// parseQValues parses a header with q-values, e.g. "gzip;q=0.8, br" --> {"gzip": 0.8, "br": 1}
+func parseQValues(header string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			key, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = parsed
+			}
+		}
+		res[value] = q
+	}
+	return res
+}
+
+// qValueOf gets the q-value of value, falling back to the one of "*"
+func qValueOf(qValues map[string]float64, value string) float64 {
+	if q, ok := qValues[value]; ok {
+		return q
+	}
+	return qValues["*"]
+}
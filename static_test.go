@@ -0,0 +1,345 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Test: serve files of fs.FS under a prefix
+func TestHTTPServer_Static(t *testing.T) {
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>"), ModTime: modTime},
+		"app.js":            {Data: []byte("console.log('plain')"), ModTime: modTime},
+		"app.js.gz":         {Data: []byte("gzip content"), ModTime: modTime},
+		"app.js.br":         {Data: []byte("br content"), ModTime: modTime},
+		"docs/readme.txt":   {Data: []byte("0123456789"), ModTime: modTime},
+		"docs/a b.txt":      {Data: []byte("space"), ModTime: modTime},
+		"private/notes.txt": {Data: []byte("secret"), ModTime: modTime},
+	}
+
+	h := NewHTTPServer()
+	h.Static("/static", fsys,
+		StaticWithCacheControl("public, max-age=31536000, immutable", ".js"),
+		StaticWithCacheControl("no-cache"))
+	h.Static("/files", fsys, StaticWithDirectoryListing())
+	h.Get("/api", func(ctx *Context) {
+		ctx.Resp.Write([]byte("api"))
+	})
+
+	etag := fileETag(mustStat(t, fsys, "docs/readme.txt"))
+
+	testCases := []struct {
+		caseName   string
+		method     string
+		url        string
+		header     map[string]string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			caseName: "file with default cache control",
+			method:   http.MethodGet,
+			url:      "/static/docs/readme.txt",
+			wantCode: http.StatusOK,
+			wantBody: "0123456789",
+			wantHeader: map[string]string{
+				"Cache-Control": "no-cache",
+				"Content-Type":  "text/plain; charset=utf-8",
+				"ETag":          etag,
+				"Last-Modified": modTime.Format(http.TimeFormat),
+			},
+		},
+		{
+			caseName: "index file of root",
+			method:   http.MethodGet,
+			url:      "/static/",
+			wantCode: http.StatusOK,
+			wantBody: "<h1>home</h1>",
+		},
+		{
+			caseName:   "redirect directory to trailing slash",
+			method:     http.MethodGet,
+			url:        "/static",
+			wantCode:   http.StatusMovedPermanently,
+			wantHeader: map[string]string{"Location": "/static/"},
+		},
+		{
+			caseName: "no directory listing by default",
+			method:   http.MethodGet,
+			url:      "/static/docs/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName: "directory listing",
+			method:   http.MethodGet,
+			url:      "/files/docs/",
+			wantCode: http.StatusOK,
+			wantBody: "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n" +
+				"<a href=\"a%20b.txt\">a b.txt</a>\n<a href=\"readme.txt\">readme.txt</a>\n</pre>\n",
+		},
+		{
+			caseName: "path traversal stays in root",
+			method:   http.MethodGet,
+			url:      "/static/docs/../../../private/notes.txt",
+			wantCode: http.StatusOK,
+			wantBody: "secret",
+		},
+		{
+			caseName: "not exist",
+			method:   http.MethodGet,
+			url:      "/static/no.txt",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName: "routes win over static files",
+			method:   http.MethodGet,
+			url:      "/api",
+			wantCode: http.StatusOK,
+			wantBody: "api",
+		},
+		{
+			caseName: "if-none-match",
+			method:   http.MethodGet,
+			url:      "/static/docs/readme.txt",
+			header:   map[string]string{"If-None-Match": etag},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			caseName: "if-modified-since",
+			method:   http.MethodGet,
+			url:      "/static/docs/readme.txt",
+			header:   map[string]string{"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			caseName:   "range",
+			method:     http.MethodGet,
+			url:        "/static/docs/readme.txt",
+			header:     map[string]string{"Range": "bytes=2-5"},
+			wantCode:   http.StatusPartialContent,
+			wantBody:   "2345",
+			wantHeader: map[string]string{"Content-Range": "bytes 2-5/10"},
+		},
+		{
+			caseName: "head",
+			method:   http.MethodHead,
+			url:      "/static/docs/readme.txt",
+			wantCode: http.StatusOK,
+			wantBody: "",
+		},
+		{
+			caseName: "precompressed brotli preferred",
+			method:   http.MethodGet,
+			url:      "/static/app.js",
+			header:   map[string]string{"Accept-Encoding": "gzip, deflate, br"},
+			wantCode: http.StatusOK,
+			wantBody: "br content",
+			wantHeader: map[string]string{
+				"Content-Encoding": "br",
+				"Content-Type":     "text/javascript; charset=utf-8",
+				"Cache-Control":    "public, max-age=31536000, immutable",
+				"Vary":             "Accept-Encoding",
+			},
+		},
+		{
+			caseName:   "precompressed by q-values",
+			method:     http.MethodGet,
+			url:        "/static/app.js",
+			header:     map[string]string{"Accept-Encoding": "br;q=0.5, gzip"},
+			wantCode:   http.StatusOK,
+			wantBody:   "gzip content",
+			wantHeader: map[string]string{"Content-Encoding": "gzip"},
+		},
+		{
+			caseName:   "no precompressed",
+			method:     http.MethodGet,
+			url:        "/static/app.js",
+			header:     map[string]string{"Accept-Encoding": "identity, br;q=0"},
+			wantCode:   http.StatusOK,
+			wantBody:   "console.log('plain')",
+			wantHeader: map[string]string{"Content-Encoding": ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			for key, value := range tc.header {
+				req.Header.Set(key, value)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode/100 == 2 {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+			for key, value := range tc.wantHeader {
+				assert.Equal(t, value, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestParseQValues(t *testing.T) {
+	assert.Equal(t, map[string]float64{"gzip": 0.8, "br": 1, "*": 0},
+		parseQValues("gzip;q=0.8, BR ,*;q=0"))
+}
+
+func mustStat(t *testing.T, fsys fs.FS, name string) fs.FileInfo {
+	t.Helper()
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// Test: unknown paths of HTML navigation requests are served with the entry file
+func TestHTTPServer_StaticSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<div id=app></div>")},
+		"assets/app.js": {Data: []byte("app()")},
+		"api/doc.txt":   {Data: []byte("doc")},
+	}
+
+	h := NewHTTPServer()
+	h.Static("/app", fsys, StaticWithSPA("index.html"))
+	h.Get("/app/api/users", func(ctx *Context) {
+		ctx.Resp.Write([]byte("users"))
+	})
+	// routes next to the files do not hide them
+	h.Get("/app/assets/manifest", func(ctx *Context) {
+		ctx.Resp.Write([]byte("manifest"))
+	})
+
+	const navigation = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	testCases := []struct {
+		caseName string
+		method   string
+		url      string
+		accept   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseName: "client-side route",
+			method:   http.MethodGet,
+			url:      "/app/users/42/edit",
+			accept:   navigation,
+			wantCode: http.StatusOK,
+			wantBody: "<div id=app></div>",
+		},
+		{
+			caseName: "client-side route looking like a directory",
+			method:   http.MethodGet,
+			url:      "/app/assets/",
+			accept:   navigation,
+			wantCode: http.StatusOK,
+			wantBody: "<div id=app></div>",
+		},
+		{
+			caseName: "existing asset",
+			method:   http.MethodGet,
+			url:      "/app/assets/app.js",
+			accept:   "*/*",
+			wantCode: http.StatusOK,
+			wantBody: "app()",
+		},
+		{
+			caseName: "missing asset",
+			method:   http.MethodGet,
+			url:      "/app/assets/missing.js",
+			accept:   "*/*",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseName: "api route",
+			method:   http.MethodGet,
+			url:      "/app/api/users",
+			accept:   navigation,
+			wantCode: http.StatusOK,
+			wantBody: "users",
+		},
+		{
+			caseName: "route next to the assets",
+			method:   http.MethodGet,
+			url:      "/app/assets/manifest",
+			accept:   "*/*",
+			wantCode: http.StatusOK,
+			wantBody: "manifest",
+		},
+		{
+			caseName: "file next to a route",
+			method:   http.MethodGet,
+			url:      "/app/api/doc.txt",
+			accept:   "*/*",
+			wantCode: http.StatusOK,
+			wantBody: "doc",
+		},
+		{
+			caseName: "client-side route next to a route",
+			method:   http.MethodGet,
+			url:      "/app/api/users/42",
+			accept:   navigation,
+			wantCode: http.StatusOK,
+			wantBody: "<div id=app></div>",
+		},
+		{
+			caseName: "text/html refused",
+			method:   http.MethodGet,
+			url:      "/app/users",
+			accept:   "text/html;q=0, */*",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			req.Header.Set("Accept", tc.accept)
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode/100 == 2 {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// Test: files without modification time, e.g. of embed.FS, get ETags by content
+func TestHTTPServer_StaticContentETag(t *testing.T) {
+	serve := func(h *HTTPServer, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/assets/a.js", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		return recorder
+	}
+	oldServer, newServer := NewHTTPServer(), NewHTTPServer()
+	oldServer.Static("/assets", fstest.MapFS{"a.js": {Data: []byte("AAAA")}})
+	newServer.Static("/assets", fstest.MapFS{"a.js": {Data: []byte("BBBB")}})
+
+	oldETag := serve(oldServer, "").Header().Get("ETag")
+	recorder := serve(newServer, "")
+	newETag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, oldETag)
+	assert.NotEqual(t, oldETag, newETag)
+	assert.Equal(t, "BBBB", recorder.Body.String())
+
+	// a new version after a deploy
+	recorder = serve(newServer, oldETag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "BBBB", recorder.Body.String())
+	// the cached hash
+	assert.Equal(t, http.StatusNotModified, serve(newServer, newETag).Code)
+}
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// TemplateEngine renders templates, see ServerWithTemplateEngine and Context.Render
+type TemplateEngine interface {
+	// Render renders the template name with data
+	Render(ctx context.Context, name string, data any) ([]byte, error)
+}
+
+// ServerWithTemplateEngine sets the template engine used by Context.Render
+func ServerWithTemplateEngine(engine TemplateEngine) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.tplEngine = engine
+		if e, ok := engine.(*GoTemplateEngine); ok {
+			e.urlFor = server.URLFor
+		}
+	}
+}
+
+// GoTemplateEngine is a TemplateEngine of html/template loading templates from a fs.FS.
+//
+// Each page is parsed along with all the layouts and partials, so that pages can define the same blocks
+// without conflicts. With a layout, e.g. "layouts/base.html" containing {{block "content" .}}{{end}},
+// rendering a page executes the layout with the blocks defined in the page.
+//
+// Besides custom funcs, templates can call {{url "route name" "key" "value"}} to build the path of a named
+// route, see RouteName. It works after the engine is set by ServerWithTemplateEngine.
+type GoTemplateEngine struct {
+	fsys     fs.FS
+	pages    []string // glob patterns of pages
+	shared   []string // glob patterns of layouts and partials
+	layout   string   // name of the layout executed for pages, "" to execute pages directly
+	funcs    template.FuncMap
+	devMode  bool
+	urlFor   func(name string, params ...string) (string, error)
+	mu       sync.RWMutex
+	tpls     map[string]*template.Template // page name --> templates to execute
+	modTimes map[string]time.Time          // modification time of files when parsed, for dev mode
+}
+
+// GoTemplateOption configures a GoTemplateEngine
+type GoTemplateOption func(e *GoTemplateEngine)
+
+// GoTemplateWithPages sets the glob patterns of pages. Default is "*.html".
+func GoTemplateWithPages(patterns ...string) GoTemplateOption {
+	return func(e *GoTemplateEngine) {
+		e.pages = patterns
+	}
+}
+
+// GoTemplateWithShared sets the glob patterns of layouts and partials shared by all pages,
+// e.g. "layouts/*.html", "partials/*.html"
+func GoTemplateWithShared(patterns ...string) GoTemplateOption {
+	return func(e *GoTemplateEngine) {
+		e.shared = patterns
+	}
+}
+
+// GoTemplateWithLayout sets the layout executed when rendering pages
+func GoTemplateWithLayout(name string) GoTemplateOption {
+	return func(e *GoTemplateEngine) {
+		e.layout = name
+	}
+}
+
+// GoTemplateWithFuncs adds funcs to templates
+func GoTemplateWithFuncs(funcs template.FuncMap) GoTemplateOption {
+	return func(e *GoTemplateEngine) {
+		for name, fn := range funcs {
+			e.funcs[name] = fn
+		}
+	}
+}
+
+// GoTemplateWithDevMode re-parses the templates before rendering if any file has changed.
+// It costs a stat of each file per render, so it is for development only.
+func GoTemplateWithDevMode() GoTemplateOption {
+	return func(e *GoTemplateEngine) {
+		e.devMode = true
+	}
+}
+
+// NewGoTemplateEngine constructs a GoTemplateEngine and parses the templates
+func NewGoTemplateEngine(fsys fs.FS, opts ...GoTemplateOption) (*GoTemplateEngine, error) {
+	e := &GoTemplateEngine{
+		fsys:  fsys,
+		pages: []string{"*.html"},
+		funcs: template.FuncMap{},
+	}
+	e.funcs["url"] = func(name string, params ...string) (string, error) {
+		if e.urlFor == nil {
+			return "", errors.New("template engine is not set to a server")
+		}
+		return e.urlFor(name, params...)
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if err := e.parse(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Render renders the page name with data
+func (e *GoTemplateEngine) Render(ctx context.Context, name string, data any) ([]byte, error) {
+	if e.devMode {
+		if err := e.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	e.mu.RLock()
+	tpl, ok := e.tpls[name]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+
+	execName := name
+	if e.layout != "" {
+		execName = e.layout
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, execName, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parse parses all the pages, each along with the shared templates
+func (e *GoTemplateEngine) parse() error {
+	sharedFiles, err := e.glob(e.shared)
+	if err != nil {
+		return err
+	}
+	pageFiles, err := e.glob(e.pages)
+	if err != nil {
+		return err
+	}
+	modTimes, err := e.stat(append(sharedFiles, pageFiles...))
+	if err != nil {
+		return err
+	}
+
+	base := template.New("").Funcs(e.funcs)
+	for _, file := range sharedFiles {
+		if err = e.parseFile(base, file); err != nil {
+			return err
+		}
+	}
+	tpls := make(map[string]*template.Template, len(pageFiles))
+	for _, file := range pageFiles {
+		tpl, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if err = e.parseFile(tpl, file); err != nil {
+			return err
+		}
+		tpls[file] = tpl
+	}
+
+	e.mu.Lock()
+	e.tpls, e.modTimes = tpls, modTimes
+	e.mu.Unlock()
+	return nil
+}
+
+// parseFile parses a file as a template named by its path
+func (e *GoTemplateEngine) parseFile(tpl *template.Template, file string) error {
+	content, err := fs.ReadFile(e.fsys, file)
+	if err != nil {
+		return err
+	}
+	_, err = tpl.New(file).Parse(string(content))
+	return err
+}
+
+// reloadIfChanged re-parses the templates if any file is added, removed or modified
+func (e *GoTemplateEngine) reloadIfChanged() error {
+	files, err := e.glob(append(append([]string{}, e.shared...), e.pages...))
+	if err != nil {
+		return err
+	}
+	modTimes, err := e.stat(files)
+	if err != nil {
+		return err
+	}
+	e.mu.RLock()
+	changed := len(modTimes) != len(e.modTimes)
+	for file, modTime := range modTimes {
+		if old, ok := e.modTimes[file]; !ok || !old.Equal(modTime) {
+			changed = true
+			break
+		}
+	}
+	e.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return e.parse()
+}
+
+// glob finds the files matching the patterns, without duplicates
+func (e *GoTemplateEngine) glob(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(e.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// stat gets the modification time of files
+func (e *GoTemplateEngine) stat(files []string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := fs.Stat(e.fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
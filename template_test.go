@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Test: render pages with layout, partials, funcs and reverse routing
+func TestContext_Render(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":   {Data: []byte(`<title>{{block "title" .}}default{{end}}</title>{{block "content" .}}{{end}}`)},
+		"partials/nav.html":   {Data: []byte(`{{define "nav"}}<a href="{{url "user" "id" "42"}}">me</a>{{end}}`)},
+		"pages/user.html":     {Data: []byte(`{{define "title"}}{{upper .Name}}{{end}}{{define "content"}}{{template "nav"}}<p>{{.Name}}</p>{{end}}`)},
+		"pages/plain.html":    {Data: []byte(`{{define "content"}}<p>{{.}}</p>{{end}}`)},
+		"not-a-page/any.html": {Data: []byte(`{{.Broken`)},
+	}
+	engine, err := NewGoTemplateEngine(fsys,
+		GoTemplateWithPages("pages/*.html"),
+		GoTemplateWithShared("layouts/*.html", "partials/*.html"),
+		GoTemplateWithLayout("layouts/base.html"),
+		GoTemplateWithFuncs(template.FuncMap{"upper": strings.ToUpper}))
+	require.NoError(t, err)
+
+	h := NewHTTPServer(ServerWithTemplateEngine(engine))
+	h.Get("/user/:id", func(ctx *Context) {
+		err := ctx.Render(http.StatusOK, "pages/user.html", map[string]string{"Name": "<tom>"})
+		assert.NoError(t, err)
+	}, RouteName("user"))
+	h.Get("/plain", func(ctx *Context) {
+		err := ctx.Render(http.StatusCreated, "pages/plain.html", "hi")
+		assert.NoError(t, err)
+	})
+	h.Get("/missing", func(ctx *Context) {
+		err := ctx.Render(http.StatusOK, "pages/missing.html", nil)
+		assert.Error(t, err)
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `<title>&lt;TOM&gt;</title><a href="/user/42">me</a><p>&lt;tom&gt;</p>`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, `<title>default</title><p>hi</p>`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, "", recorder.Body.String())
+
+	// no template engine
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil), Resp: httptest.NewRecorder()}
+	assert.Error(t, ctx.Render(http.StatusOK, "pages/plain.html", nil))
+}
+
+// Test: templates are re-parsed in dev mode when files change
+func TestGoTemplateEngine_DevMode(t *testing.T) {
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`v1 {{.}}`), ModTime: modTime},
+	}
+	engine, err := NewGoTemplateEngine(fsys)
+	require.NoError(t, err)
+	devEngine, err := NewGoTemplateEngine(fsys, GoTemplateWithDevMode())
+	require.NoError(t, err)
+
+	fsys["index.html"] = &fstest.MapFile{Data: []byte(`v2 {{.}}`), ModTime: modTime.Add(time.Second)}
+	fsys["new.html"] = &fstest.MapFile{Data: []byte(`new`), ModTime: modTime}
+
+	page, err := engine.Render(context.Background(), "index.html", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "v1 a", string(page))
+
+	page, err = devEngine.Render(context.Background(), "index.html", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "v2 a", string(page))
+	page, err = devEngine.Render(context.Background(), "new.html", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(page))
+}
+
+// Test: build the path of named routes
+func TestRouter_URLFor(t *testing.T) {
+	var mockHandler = func(ctx *Context) {}
+	r := newRouter()
+	r.AddRoute(http.MethodGet, "/", mockHandler, RouteName("root"))
+	r.AddRoute(http.MethodGet, "/user/:id/home", mockHandler, RouteName("home"))
+	r.AddRoute(http.MethodHead, "/user/:id/home", mockHandler, RouteName("home"))
+	r.AddRoute(http.MethodGet, "/order/:id((\\d+))", mockHandler, RouteName("order"))
+	r.AddRoute(http.MethodGet, "/files/*", mockHandler, RouteName("files"))
+	assert.Panicsf(t, func() {
+		r.AddRoute(http.MethodGet, "/other", mockHandler, RouteName("home"))
+	}, "Duplicate route name")
+
+	testCases := []struct {
+		caseName string
+		name     string
+		params   []string
+		wantURL  string
+		wantErr  bool
+	}{
+		{caseName: "root", name: "root", wantURL: "/"},
+		{caseName: "param", name: "home", params: []string{"id", "a/b c"}, wantURL: "/user/a%2Fb%20c/home"},
+		{caseName: "regexp", name: "order", params: []string{"id", "42"}, wantURL: "/order/42"},
+		{caseName: "wildcard", name: "files", params: []string{"*", "a b/c.txt"}, wantURL: "/files/a%20b/c.txt"},
+		{caseName: "missing param", name: "home", wantErr: true},
+		{caseName: "odd params", name: "home", params: []string{"id"}, wantErr: true},
+		{caseName: "unknown route", name: "no", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			u, err := r.URLFor(tc.name, tc.params...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantURL, u)
+		})
+	}
+}
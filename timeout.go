@@ -0,0 +1,290 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutConfig configures the timeout middleware
+type TimeoutConfig struct {
+	Timeout time.Duration
+	// Code is responded when the handler overruns, 503 or 504. Default is 503.
+	Code int
+}
+
+// Timeout is the timeout middleware. The handler runs with a deadline on ctx.Req.Context(), see
+// Context.TimeRemaining. If it overruns, the error handler responds Code, and whatever the handler writes
+// later is discarded. The handler should return once the context is done and stop using ctx, as the
+// response goes on without it.
+//
+// The response is buffered so that the error can still be responded, until the handler flushes: a streaming
+// handler is cut at the deadline without the error response.
+//
+// A Timeout inside another one, e.g. on a Group, overrides the deadline and Code, longer or shorter,
+// counting from when it runs.
+func Timeout(cfg TimeoutConfig) Middleware {
+	if cfg.Timeout <= 0 {
+		panic("timeout should be positive")
+	}
+	if cfg.Code == 0 {
+		cfg.Code = http.StatusServiceUnavailable
+	}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.timeout != nil {
+				ctx.timeout.reset(cfg.Timeout, cfg.Code)
+				next(ctx)
+				return
+			}
+
+			tw := &timeoutWriter{w: ctx.Resp, header: ctx.Resp.Header().Clone()}
+			tctx := newTimeoutContext(ctx.Req.Context(), cfg.Timeout, cfg.Code, tw.timeout)
+			defer tctx.cancel(context.Canceled)
+			// The handler runs on a copy, so that ctx stays with the outer middlewares even if the handler
+			// overruns
+			hctx := *ctx
+			hctx.Req = ctx.Req.WithContext(tctx)
+			hctx.Resp = tw
+			hctx.timeout = tctx
+
+			finished := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+						return
+					}
+					close(finished)
+				}()
+				next(&hctx)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-finished:
+				tw.commit()
+				return
+			case <-tctx.Done():
+			}
+			// Nothing to respond if the client is gone
+			if tctx.Err() == context.DeadlineExceeded && !tw.flushed() {
+				ctx.Error(&HTTPError{Code: tctx.code, Err: context.DeadlineExceeded})
+			}
+		}
+	}
+}
+
+// TimeRemaining is how long the handler has until the deadline of the request, see Timeout.
+// It reports false if the request has no deadline.
+func (c *Context) TimeRemaining() (time.Duration, bool) {
+	deadline, ok := c.Req.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// timeoutContext is canceled at a deadline which can be reset by an inner Timeout,
+// unlike the one of context.WithDeadline
+type timeoutContext struct {
+	context.Context
+	done     chan struct{}
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	gen      int // generation of timer, so that a stale timer does not cancel
+	code     int
+	err      error
+	// onCancel is called right before done is closed, so that the writes after are discarded
+	onCancel func()
+}
+
+func newTimeoutContext(parent context.Context, d time.Duration, code int, onCancel func()) *timeoutContext {
+	c := &timeoutContext{Context: parent, done: make(chan struct{}), code: code, onCancel: onCancel}
+	c.mu.Lock()
+	c.startTimerLocked(d)
+	c.mu.Unlock()
+	if parentDone := parent.Done(); parentDone != nil {
+		go func() {
+			select {
+			case <-parentDone:
+				c.cancel(parent.Err())
+			case <-c.done:
+			}
+		}()
+	}
+	return c
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if parentDeadline, ok := c.Context.Deadline(); ok && parentDeadline.Before(deadline) {
+		return parentDeadline, true
+	}
+	return deadline, true
+}
+
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *timeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// reset moves the deadline to d from now, and the code to respond at it
+func (c *timeoutContext) reset(d time.Duration, code int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.timer.Stop()
+	c.startTimerLocked(d)
+	c.code = code
+}
+
+func (c *timeoutContext) startTimerLocked(d time.Duration) {
+	c.gen++
+	gen := c.gen
+	c.deadline = time.Now().Add(d)
+	c.timer = time.AfterFunc(d, func() {
+		c.mu.Lock()
+		stale := gen != c.gen
+		c.mu.Unlock()
+		if !stale {
+			c.cancel(context.DeadlineExceeded)
+		}
+	})
+}
+
+func (c *timeoutContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		c.timer.Stop()
+		if c.onCancel != nil {
+			c.onCancel()
+		}
+		close(c.done)
+	}
+}
+
+// timeoutWriter buffers the response of the handler until it finishes or flushes, and discards the writes
+// after the deadline
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	passThrough bool // flushed, the writes go to w directly
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader, tw.code = true, code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.passThrough {
+		return tw.w.Write(b)
+	}
+	if !tw.wroteHeader {
+		tw.wroteHeader, tw.code = true, http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// Flush switches to pass-through, so that streaming responses are not held back
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.passThrough {
+		tw.passThrough = true
+		if !tw.wroteHeader {
+			tw.wroteHeader, tw.code = true, http.StatusOK
+		}
+		tw.writeBufferedLocked()
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// commit writes the buffered response after the handler finished in time.
+// Nothing is written if the handler wrote nothing, so that outer middlewares can still respond.
+func (tw *timeoutWriter) commit() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.passThrough {
+		return
+	}
+	tw.writeBufferedLocked()
+}
+
+// timeout discards the writes from now on
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.timedOut = true
+}
+
+// flushed reports whether the response has been sent partly, so that the error cannot be responded
+func (tw *timeoutWriter) flushed() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.passThrough
+}
+
+func (tw *timeoutWriter) writeBufferedLocked() {
+	dst := tw.w.Header()
+	for key := range dst {
+		if _, ok := tw.header[key]; !ok {
+			dst.Del(key)
+		}
+	}
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+	if !tw.wroteHeader {
+		return
+	}
+	tw.w.WriteHeader(tw.code)
+	tw.w.Write(tw.buf.Bytes())
+	tw.buf.Reset()
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test: handlers finishing in time, overrunning, overridden by groups and streaming
+func TestTimeout(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	h := NewHTTPServer(ServerWithMiddleware(Timeout(TimeoutConfig{Timeout: 20 * time.Millisecond})))
+	h.Get("/fast", func(ctx *Context) {
+		remaining, ok := ctx.TimeRemaining()
+		if ok && remaining > 0 && remaining <= 20*time.Millisecond {
+			ctx.Resp.Header().Set("X-Budget", "ok")
+		}
+		ctx.Resp.WriteHeader(http.StatusCreated)
+		ctx.Resp.Write([]byte("fast"))
+	})
+	h.Get("/slow", func(ctx *Context) {
+		ctx.Resp.Header().Set("X-Handler", "slow")
+		<-ctx.Req.Context().Done()
+		_, err := ctx.Resp.Write([]byte("late"))
+		lateWrite <- err
+	})
+	h.Get("/stream", func(ctx *Context) {
+		ctx.Resp.Write([]byte("part 1;"))
+		http.NewResponseController(ctx.Resp).Flush()
+		<-ctx.Req.Context().Done()
+		ctx.Resp.Write([]byte("part 2;"))
+	})
+	h.Group("/reports", Timeout(TimeoutConfig{Timeout: time.Second})).Get("/", func(ctx *Context) {
+		time.Sleep(50 * time.Millisecond)
+		ctx.Resp.Write([]byte("report"))
+	})
+	h.Group("/search", Timeout(TimeoutConfig{Timeout: time.Millisecond, Code: http.StatusGatewayTimeout})).
+		Get("/", func(ctx *Context) {
+			<-ctx.Req.Context().Done()
+		})
+
+	testCases := []struct {
+		caseName   string
+		path       string
+		wantCode   int
+		wantBody   string
+		wantHeader http.Header
+	}{
+		{caseName: "In time", path: "/fast", wantCode: http.StatusCreated, wantBody: "fast",
+			wantHeader: http.Header{"X-Budget": {"ok"}}},
+		{caseName: "Overrun", path: "/slow", wantCode: http.StatusServiceUnavailable, wantBody: "Service Unavailable\n",
+			wantHeader: http.Header{"X-Handler": nil}},
+		{caseName: "Streaming", path: "/stream", wantCode: http.StatusOK, wantBody: "part 1;"},
+		{caseName: "Longer by group", path: "/reports", wantCode: http.StatusOK, wantBody: "report"},
+		{caseName: "Shorter by group", path: "/search", wantCode: http.StatusGatewayTimeout, wantBody: "Gateway Timeout\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			for key, values := range tc.wantHeader {
+				assert.Equal(t, values, recorder.Header()[key])
+			}
+		})
+	}
+	assert.ErrorIs(t, <-lateWrite, http.ErrHandlerTimeout)
+}
+
+// Test: a panic of the handler goroutine goes on in the serving one
+func TestTimeout_Panic(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddleware(Timeout(TimeoutConfig{Timeout: time.Second})))
+	h.Get("/", func(ctx *Context) {
+		panic("boom")
+	})
+	assert.PanicsWithValue(t, "boom", func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	// no deadline without the middleware
+	_, ok := (&Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}).TimeRemaining()
+	assert.False(t, ok)
+}
+
+// Test: middlewares outside restore ctx while the overrunning handler still runs, its writes are discarded
+func TestTimeout_WrappedByMiddleware(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	h := NewHTTPServer(ServerWithMiddleware(
+		Sessions(SessionConfig{Store: NewMemoryStore()}),
+		Compress(CompressConfig{}),
+		Timeout(TimeoutConfig{Timeout: 10 * time.Millisecond}),
+	))
+	h.Get("/slow", func(ctx *Context) {
+		time.Sleep(50 * time.Millisecond)
+		_, err := ctx.Resp.Write([]byte("late"))
+		lateWrite <- err
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.ErrorIs(t, <-lateWrite, http.ErrHandlerTimeout)
+	assert.Equal(t, "Service Unavailable\n", recorder.Body.String())
+}
@@ -0,0 +1,246 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxMemory is the default memory limit of parsing a multipart form, same as net/http
+const defaultMaxMemory = 32 << 20
+
+// sniffLen is the number of bytes http.DetectContentType considers
+const sniffLen = 512
+
+var (
+	// ErrTooManyFiles is returned when a multipart body has more files than UploadLimits.MaxFiles
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrFileTypeNotAllowed is returned when the sniffed type of a file is not in UploadLimits.AllowedTypes
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+)
+
+// UploadLimits limits the multipart uploads of a request, see UploadLimit
+type UploadLimits struct {
+	// MaxBytes limits the size of the whole request body, 0 for unlimited
+	MaxBytes int64
+	// MaxFiles limits the number of files, 0 for unlimited
+	MaxFiles int
+	// AllowedTypes are the MIME types files may have, e.g. "image/png" or "image/*", empty for any.
+	// The type is sniffed from the content by http.DetectContentType, the header from client is not trusted.
+	AllowedTypes []string
+	// MaxMemory is the memory FormFile parses the form in, the rest goes to temporary files. Default 32MB.
+	MaxMemory int64
+}
+
+// UploadLimit applies limits to the multipart uploads. Wrap a handler with it for a per-route limit, e.g.
+//
+//	h.Post("/avatar", UploadLimit(UploadLimits{MaxBytes: 1 << 20, AllowedTypes: []string{"image/*"}})(handler))
+func UploadLimit(limits UploadLimits) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if limits.MaxBytes > 0 && ctx.Req.Body != nil {
+				ctx.Req.Body = http.MaxBytesReader(ctx.Resp, ctx.Req.Body, limits.MaxBytes)
+			}
+			ctx.uploadLimits = &limits
+			next(ctx)
+		}
+	}
+}
+
+// FormFile gets the first file of form field name from a multipart body.
+// The whole form is parsed and checked against the upload limits at the first call.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, err
+	}
+	files := c.Req.MultipartForm.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// parseMultipartForm parses the multipart form once, and checks the files against the upload limits.
+// A form failing the check is removed, the error is returned by every call.
+func (c *Context) parseMultipartForm() error {
+	if !c.multipartParsed {
+		c.multipartParsed = true
+		c.multipartErr = c.checkMultipartForm()
+		if c.multipartErr != nil && c.Req.MultipartForm != nil {
+			c.Req.MultipartForm.RemoveAll()
+			c.Req.MultipartForm = nil
+		}
+	}
+	return c.multipartErr
+}
+
+// checkMultipartForm parses the multipart form and checks the files against the upload limits
+func (c *Context) checkMultipartForm() error {
+	limits := c.uploadLimits
+	if limits == nil {
+		limits = &UploadLimits{}
+	}
+	maxMemory := limits.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMaxMemory
+	}
+	if err := c.Req.ParseMultipartForm(maxMemory); err != nil {
+		return bodyError(err)
+	}
+
+	count := 0
+	for _, files := range c.Req.MultipartForm.File {
+		count += len(files)
+		if limits.MaxFiles > 0 && count > limits.MaxFiles {
+			return ErrTooManyFiles
+		}
+		if len(limits.AllowedTypes) == 0 {
+			continue
+		}
+		for _, fh := range files {
+			if err := checkFileType(fh, limits.AllowedTypes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFileType sniffs the type of an uploaded file
+func checkFileType(fh *multipart.FileHeader, allowedTypes []string) error {
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	return allowType(http.DetectContentType(head[:n]), allowedTypes)
+}
+
+// allowType checks the sniffed type against the allowed ones
+func allowType(sniffed string, allowedTypes []string) error {
+	mediaType, _, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		mediaType = sniffed
+	}
+	for _, allowed := range allowedTypes {
+		if strings.EqualFold(allowed, mediaType) {
+			return nil
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, mediaType)
+}
+
+// MultipartReader reads a multipart body part by part without buffering it, for very large uploads.
+// The upload limits are checked as the parts are read.
+func (c *Context) MultipartReader() (*MultipartReader, error) {
+	r, err := c.Req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	limits := c.uploadLimits
+	if limits == nil {
+		limits = &UploadLimits{}
+	}
+	return &MultipartReader{r: r, limits: limits}, nil
+}
+
+// MultipartReader streams the parts of a multipart body, see Context.MultipartReader
+type MultipartReader struct {
+	r      *multipart.Reader
+	limits *UploadLimits
+	files  int
+}
+
+// UploadPart is a part of a multipart body. Read the content from it rather than from the embedded Part.
+type UploadPart struct {
+	*multipart.Part
+	// ContentType is sniffed from the content for file parts, empty for the other fields
+	ContentType string
+	r           io.Reader
+}
+
+// Read reads the content of the part
+func (p *UploadPart) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	return n, bodyError(err)
+}
+
+// NextPart returns the next part, or io.EOF if there are no more parts
+func (mr *MultipartReader) NextPart() (*UploadPart, error) {
+	part, err := mr.r.NextPart()
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	up := &UploadPart{Part: part, r: part}
+	if part.FileName() == "" {
+		return up, nil
+	}
+
+	mr.files++
+	if mr.limits.MaxFiles > 0 && mr.files > mr.limits.MaxFiles {
+		return nil, ErrTooManyFiles
+	}
+	// Peek the head to sniff, without losing it
+	br := bufio.NewReaderSize(part, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, bodyError(err)
+	}
+	up.ContentType = http.DetectContentType(head)
+	up.r = br
+	if len(mr.limits.AllowedTypes) > 0 {
+		if err = allowType(up.ContentType, mr.limits.AllowedTypes); err != nil {
+			return nil, err
+		}
+	}
+	return up, nil
+}
+
+// SaveUploadedFile saves an uploaded file to dst atomically, see SaveUpload
+func SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return SaveUpload(f, dst)
+}
+
+// SaveUpload saves the content of src to dst atomically: it is written to a temporary file in the directory
+// of dst first, then renamed to dst. So dst is never seen half-written, even if the upload is interrupted.
+func SaveUpload(src io.Reader, dst string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file unless it has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
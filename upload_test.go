@@ -0,0 +1,190 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var pngHead = []byte("\x89PNG\x0D\x0A\x1A\x0A fake image")
+
+type uploadFile struct {
+	field    string
+	filename string
+	content  []byte
+}
+
+// newUploadRequest makes a multipart request with a field "title" and files
+func newUploadRequest(t *testing.T, files ...uploadFile) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("title", "hello"))
+	for _, f := range files {
+		// the client claims any type it likes
+		fw, err := w.CreateFormFile(f.field, f.filename)
+		require.NoError(t, err)
+		_, err = fw.Write(f.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+// Test: parse uploaded files with limits
+func TestContext_FormFile(t *testing.T) {
+	testCases := []struct {
+		caseName  string
+		limits    *UploadLimits
+		files     []uploadFile
+		wantTitle string
+		wantFile  string
+		wantErr   error
+	}{
+		{
+			caseName:  "no limits",
+			files:     []uploadFile{{field: "file", filename: "a.txt", content: []byte("text")}},
+			wantTitle: "hello",
+			wantFile:  "text",
+		},
+		{
+			caseName:  "sniffed type allowed",
+			limits:    &UploadLimits{AllowedTypes: []string{"image/*"}},
+			files:     []uploadFile{{field: "file", filename: "a.txt", content: pngHead}},
+			wantTitle: "hello",
+			wantFile:  string(pngHead),
+		},
+		{
+			caseName: "sniffed type not allowed",
+			limits:   &UploadLimits{AllowedTypes: []string{"image/png"}},
+			files:    []uploadFile{{field: "file", filename: "a.png", content: []byte("<html>not an image")}},
+			wantErr:  ErrFileTypeNotAllowed,
+		},
+		{
+			caseName: "too many files",
+			limits:   &UploadLimits{MaxFiles: 1},
+			files: []uploadFile{
+				{field: "file", filename: "a.txt", content: []byte("a")},
+				{field: "other", filename: "b.txt", content: []byte("b")},
+			},
+			wantErr: ErrTooManyFiles,
+		},
+		{
+			caseName: "body too large",
+			limits:   &UploadLimits{MaxBytes: 64},
+			files:    []uploadFile{{field: "file", filename: "a.txt", content: bytes.Repeat([]byte("a"), 128)}},
+			wantErr:  &http.MaxBytesError{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			var title, content string
+			var err, retryErr error
+			handler := func(ctx *Context) {
+				var fh *multipart.FileHeader
+				if fh, err = ctx.FormFile("file"); err != nil {
+					// the limits hold for the later calls too
+					_, retryErr = ctx.FormValue("title")
+					return
+				}
+				if title, err = ctx.FormValue("title"); err != nil {
+					return
+				}
+				f, _ := fh.Open()
+				defer f.Close()
+				data, _ := io.ReadAll(f)
+				content = string(data)
+			}
+			if tc.limits != nil {
+				handler = UploadLimit(*tc.limits)(handler)
+			}
+			h := NewHTTPServer()
+			h.Post("/upload", handler)
+			h.ServeHTTP(httptest.NewRecorder(), newUploadRequest(t, tc.files...))
+
+			if tc.wantErr != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(tc.wantErr, &maxBytesErr) {
+					assert.ErrorAs(t, err, &maxBytesErr)
+				} else {
+					assert.ErrorIs(t, err, tc.wantErr)
+				}
+				assert.Equal(t, err, retryErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTitle, title)
+			assert.Equal(t, tc.wantFile, content)
+		})
+	}
+}
+
+// Test: stream parts with limits, the sniffed head is not lost
+func TestContext_MultipartReader(t *testing.T) {
+	h := NewHTTPServer()
+	var parts []string
+	var types []string
+	var err error
+	h.Post("/upload", UploadLimit(UploadLimits{MaxFiles: 2, AllowedTypes: []string{"image/png"}})(func(ctx *Context) {
+		var mr *MultipartReader
+		if mr, err = ctx.MultipartReader(); err != nil {
+			return
+		}
+		for {
+			var part *UploadPart
+			part, err = mr.NextPart()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.FormName()+"="+string(data))
+			types = append(types, part.ContentType)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), newUploadRequest(t, uploadFile{field: "file", filename: "a.png", content: pngHead}))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []string{"title=hello", "file=" + string(pngHead)}, parts)
+	assert.Equal(t, []string{"", "image/png"}, types)
+
+	parts, types = nil, nil
+	h.ServeHTTP(httptest.NewRecorder(), newUploadRequest(t,
+		uploadFile{field: "file", filename: "a.png", content: pngHead},
+		uploadFile{field: "file", filename: "b.gif", content: []byte("GIF89a...")}))
+	assert.ErrorIs(t, err, ErrFileTypeNotAllowed)
+	assert.Equal(t, []string{"title=hello", "file=" + string(pngHead)}, parts)
+}
+
+// Test: save to disk atomically
+func TestSaveUpload(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "upload.txt")
+	require.NoError(t, SaveUpload(bytes.NewReader([]byte("content")), dst))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	// an interrupted upload leaves neither dst nor the temporary file
+	failedDst := filepath.Join(dir, "failed.txt")
+	assert.Error(t, SaveUpload(io.MultiReader(bytes.NewReader([]byte("half")), errReader{}), failedDst))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
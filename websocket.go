@@ -0,0 +1,592 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocketMessageType is the type of a data message
+type WebSocketMessageType int
+
+const (
+	TextMessage   WebSocketMessageType = 1
+	BinaryMessage WebSocketMessageType = 2
+)
+
+// Close codes of RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005 // never sent, reported when the close frame of the peer has no code
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+// opcodes of frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	defaultWebSocketMaxMessageSize = 1 << 20
+	// webSocketWriteWait bounds a write, so that a client not reading cannot block the writer forever
+	webSocketWriteWait = 10 * time.Second
+	// webSocketGUID is appended to the key to compute Sec-WebSocket-Accept
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// ErrWebSocketClosed is returned when using a connection that has been closed
+var ErrWebSocketClosed = errors.New("websocket is closed")
+
+// CloseError is returned by WebSocketConn.ReadMessage when the connection is closed by a close frame,
+// either sent by the peer or sent because the peer violated the protocol
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return "websocket: close " + strconv.Itoa(e.Code)
+	}
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Reason
+}
+
+// WebSocketHandler handles an upgraded connection, the connection is closed when it returns
+type WebSocketHandler func(ctx *Context, conn *WebSocketConn)
+
+// WebSocketOption configures a WebSocket route
+type WebSocketOption func(cfg *webSocketConfig)
+
+type webSocketConfig struct {
+	origins        []string
+	maxMessageSize int64
+	pingInterval   time.Duration
+	mdls           []Middleware
+}
+
+// WebSocketWithOrigins allows cross-origin handshakes from origins, e.g. "https://app.example.com", "*" allows any.
+// By default only a request without Origin, or with the Origin of the same host, is allowed.
+func WebSocketWithOrigins(origins ...string) WebSocketOption {
+	return func(cfg *webSocketConfig) {
+		cfg.origins = append(cfg.origins, origins...)
+	}
+}
+
+// WebSocketWithMaxMessageSize limits the size of a message read, the connection is closed with
+// CloseMessageTooBig over it. Default is 1 MB.
+func WebSocketWithMaxMessageSize(n int64) WebSocketOption {
+	return func(cfg *webSocketConfig) {
+		cfg.maxMessageSize = n
+	}
+}
+
+// WebSocketWithPingInterval sends a ping every interval. If nothing, pongs included, is received in two
+// intervals, ReadMessage fails, so the handler must keep reading. Disabled by default.
+func WebSocketWithPingInterval(interval time.Duration) WebSocketOption {
+	return func(cfg *webSocketConfig) {
+		cfg.pingInterval = interval
+	}
+}
+
+// WebSocketWithMiddleware runs mdls for the route before the upgrade, e.g. to authenticate.
+// A middleware rejects the upgrade by responding without calling next.
+func WebSocketWithMiddleware(mdls ...Middleware) WebSocketOption {
+	return func(cfg *webSocketConfig) {
+		cfg.mdls = append(cfg.mdls, mdls...)
+	}
+}
+
+// WebSocket adds a GET route upgraded to WebSocket by the RFC 6455 handshake. Server middlewares and the ones
+// of WebSocketWithMiddleware run before the upgrade, the handler runs after it.
+// A request which is not a valid handshake gets 426, 400, or 403 for a disallowed origin.
+func (h *HTTPServer) WebSocket(path string, handler WebSocketHandler, opts ...WebSocketOption) {
+	cfg := &webSocketConfig{maxMessageSize: defaultWebSocketMaxMessageSize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	handleFunc := func(ctx *Context) {
+		conn, ok := upgradeWebSocket(ctx, cfg)
+		if !ok {
+			return
+		}
+		defer conn.Close(CloseNormalClosure, "")
+		handler(ctx, conn)
+	}
+	for i := len(cfg.mdls) - 1; i >= 0; i-- {
+		handleFunc = cfg.mdls[i](handleFunc)
+	}
+	h.Get(path, handleFunc)
+}
+
+// upgradeWebSocket checks the handshake and hijacks the connection, or responds the error
+func upgradeWebSocket(ctx *Context, cfg *webSocketConfig) (*WebSocketConn, bool) {
+	req := ctx.Req
+	if !headerHasToken(req.Header, "Connection", "upgrade") || !headerHasToken(req.Header, "Upgrade", "websocket") {
+		ctx.Resp.Header().Set("Upgrade", "websocket")
+		http.Error(ctx.Resp, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, false
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Resp.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(ctx.Resp, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, false
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(ctx.Resp, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, false
+	}
+	if !cfg.allowOrigin(req) {
+		http.Error(ctx.Resp, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, false
+	}
+
+	// Headers set by middlewares, e.g. cookies, go along with the 101 response
+	header := ctx.Resp.Header().Clone()
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", webSocketAccept(key))
+
+	netConn, rw, err := http.NewResponseController(ctx.Resp).Hijack()
+	if err != nil {
+		http.Error(ctx.Resp, "websocket is not supported by the response writer", http.StatusInternalServerError)
+		return nil, false
+	}
+	// Deadlines of the server, e.g. ReadTimeout, do not apply to a long-lived connection
+	netConn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(rw)
+	rw.WriteString("\r\n")
+	if err = rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, false
+	}
+
+	conn := newWebSocketConn(netConn, rw.Reader, false, cfg.maxMessageSize)
+	if cfg.pingInterval > 0 {
+		conn.pongWait = 2 * cfg.pingInterval
+		go conn.keepalive(cfg.pingInterval)
+	}
+	return conn, true
+}
+
+// allowOrigin checks the Origin, so that a page of another site cannot use the cookies of the user (CSWSH)
+func (cfg *webSocketConfig) allowOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		// not from a browser
+		return true
+	}
+	for _, allowed := range cfg.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// headerHasToken reports whether the comma separated values of header key contain token, case-insensitively
+func headerHasToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// DialWebSocket connects to a WebSocket server, e.g. an httptest.Server in tests.
+// rawURL is of scheme ws, wss, http or https. header is sent with the handshake, e.g. Origin or cookies.
+// The response is returned if the server responded, including a rejected handshake.
+func DialWebSocket(ctx context.Context, rawURL string, header http.Header) (*WebSocketConn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	secure := false
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme, secure = "https", true
+	default:
+		return nil, nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		if secure {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	if secure {
+		tlsConn := tls.Client(netConn, &tls.Config{ServerName: u.Hostname()})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return nil, nil, err
+		}
+		netConn = tlsConn
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err = rand.Read(keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if header != nil {
+		req.Header = header.Clone()
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err = req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		netConn.Close()
+		return nil, resp, fmt.Errorf("websocket handshake failed with status %d", resp.StatusCode)
+	}
+	netConn.SetDeadline(time.Time{})
+	return newWebSocketConn(netConn, br, true, defaultWebSocketMaxMessageSize), resp, nil
+}
+
+// WebSocketConn is a WebSocket connection.
+// ReadMessage must be called by one goroutine at a time, writes are safe to be called concurrently.
+type WebSocketConn struct {
+	conn           net.Conn
+	br             *bufio.Reader
+	client         bool // a client masks the frames it writes, a server requires them masked
+	maxMessageSize int64
+	pongWait       time.Duration // the read deadline after each frame, none if 0
+
+	writeMu   sync.Mutex
+	closeSent bool
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newWebSocketConn(conn net.Conn, br *bufio.Reader, client bool, maxMessageSize int64) *WebSocketConn {
+	return &WebSocketConn{
+		conn:           conn,
+		br:             br,
+		client:         client,
+		maxMessageSize: maxMessageSize,
+		done:           make(chan struct{}),
+	}
+}
+
+// Done is closed when the connection is closed
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// RemoteAddr is the address of the peer
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage reads the next data message. Fragmented messages are assembled, pings are answered and pongs
+// are consumed on the way. A *CloseError is returned when the connection is closed by a close frame.
+func (c *WebSocketConn) ReadMessage() (WebSocketMessageType, []byte, error) {
+	var typ WebSocketMessageType
+	var message []byte
+	for {
+		if c.pongWait > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.pongWait))
+		}
+		fin, opcode, payload, err := c.readFrame(c.maxMessageSize - int64(len(message)))
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+		switch opcode {
+		case opPing:
+			if err = c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, c.fail(err)
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.closeReceived(payload)
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "expected continuation frame"})
+			}
+			typ = WebSocketMessageType(opcode)
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unknown opcode"})
+		}
+		message = append(message, payload...)
+		if fin {
+			if typ == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"})
+			}
+			return typ, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame whose payload is at most limit bytes if it is a data frame
+func (c *WebSocketConn) readFrame(limit int64) (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "reserved bits are set"}
+	}
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "wrong masking"}
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose {
+		if !fin || length > 125 {
+			return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+		}
+	} else if length > uint64(limit) {
+		return false, 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// closeReceived answers the close frame of the peer and closes the connection
+func (c *WebSocketConn) closeReceived(payload []byte) error {
+	code, reason := CloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(&CloseError{Code: CloseProtocolError, Reason: "invalid close frame"})
+	case len(payload) >= 2:
+		code, reason = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+		if !validCloseCode(code) || !utf8.ValidString(reason) {
+			return c.fail(&CloseError{Code: CloseProtocolError, Reason: "invalid close frame"})
+		}
+	}
+	c.writeClose(code, "")
+	c.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// validCloseCode reports whether code can be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail closes the connection for err, a *CloseError is sent to the peer first
+func (c *WebSocketConn) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		c.writeClose(closeErr.Code, closeErr.Reason)
+	} else {
+		select {
+		case <-c.done:
+			// closed by this side
+			err = ErrWebSocketClosed
+		default:
+		}
+	}
+	c.closeConn()
+	return err
+}
+
+// WriteMessage writes a data message in one frame
+func (c *WebSocketConn) WriteMessage(typ WebSocketMessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("invalid websocket message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// Close sends a close frame of code and reason then closes the connection. Closing a closed one does nothing.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	err := c.writeClose(code, reason)
+	c.closeConn()
+	if errors.Is(err, ErrWebSocketClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *WebSocketConn) writeClose(code int, reason string) error {
+	if code == CloseNoStatusReceived {
+		return c.writeFrame(opClose, nil)
+	}
+	// a control frame carries at most 125 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(reason)), uint16(code))
+	return c.writeFrame(opClose, append(payload, reason...))
+}
+
+// writeFrame writes a frame with FIN set, nothing can be written after a close frame
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrWebSocketClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(n))
+	}
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(key, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// closeConn closes the underlying connection once
+func (c *WebSocketConn) closeConn() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// keepalive pings the peer every interval until the connection is closed
+func (c *WebSocketConn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c.writeFrame(opPing, nil) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// maskBytes masks or unmasks b in place
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWebSocketServer starts a server echoing messages on "/echo", the close error is sent to closed
+func newWebSocketServer(t *testing.T, closed chan<- error, opts ...WebSocketOption) *httptest.Server {
+	h := NewHTTPServer()
+	h.WebSocket("/echo", func(ctx *Context, conn *WebSocketConn) {
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			if err = conn.WriteMessage(typ, msg); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}, opts...)
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Test: echo messages and close
+func TestHTTPServer_WebSocket(t *testing.T) {
+	closed := make(chan error, 1)
+	server := newWebSocketServer(t, closed, WebSocketWithMaxMessageSize(100_000))
+	conn, resp, err := DialWebSocket(context.Background(), server.URL+"/echo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	testCases := []struct {
+		caseName string
+		typ      WebSocketMessageType
+		msg      string
+	}{
+		{caseName: "Text", typ: TextMessage, msg: "hello"},
+		{caseName: "Empty", typ: TextMessage, msg: ""},
+		{caseName: "Binary", typ: BinaryMessage, msg: "\x00\x01\xff"},
+		{caseName: "16 bits length", typ: TextMessage, msg: strings.Repeat("a", 1000)},
+		{caseName: "64 bits length", typ: BinaryMessage, msg: strings.Repeat("b", 70_000)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			require.NoError(t, conn.WriteMessage(tc.typ, []byte(tc.msg)))
+			typ, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, tc.typ, typ)
+			assert.Equal(t, tc.msg, string(msg))
+		})
+	}
+
+	require.NoError(t, conn.Close(CloseGoingAway, "bye"))
+	assert.Equal(t, &CloseError{Code: CloseGoingAway, Reason: "bye"}, <-closed)
+	_, _, err = conn.ReadMessage()
+	assert.ErrorIs(t, err, ErrWebSocketClosed)
+}
+
+// Test: the server closes the connection when the client violates the limits or the protocol
+func TestHTTPServer_WebSocketViolation(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		send     func(conn *WebSocketConn) error
+		wantCode int
+	}{
+		{
+			caseName: "Too big",
+			send: func(conn *WebSocketConn) error {
+				return conn.WriteMessage(BinaryMessage, make([]byte, 11))
+			},
+			wantCode: CloseMessageTooBig,
+		},
+		{
+			caseName: "Invalid UTF-8",
+			send: func(conn *WebSocketConn) error {
+				return conn.WriteMessage(TextMessage, []byte{0xff})
+			},
+			wantCode: CloseInvalidPayload,
+		},
+		{
+			caseName: "Unexpected continuation",
+			send: func(conn *WebSocketConn) error {
+				return conn.writeFrame(opContinuation, []byte("a"))
+			},
+			wantCode: CloseProtocolError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			closed := make(chan error, 1)
+			server := newWebSocketServer(t, closed, WebSocketWithMaxMessageSize(10))
+			conn, _, err := DialWebSocket(context.Background(), server.URL+"/echo", nil)
+			require.NoError(t, err)
+			defer conn.Close(CloseNormalClosure, "")
+
+			require.NoError(t, tc.send(conn))
+			_, _, err = conn.ReadMessage()
+			var closeErr *CloseError
+			require.ErrorAs(t, err, &closeErr)
+			assert.Equal(t, tc.wantCode, closeErr.Code)
+			require.ErrorAs(t, <-closed, &closeErr)
+			assert.Equal(t, tc.wantCode, closeErr.Code)
+		})
+	}
+}
+
+// Test: handshakes rejected by the server, the origin check or a route middleware
+func TestHTTPServer_WebSocketHandshake(t *testing.T) {
+	h := NewHTTPServer()
+	handler := func(ctx *Context, conn *WebSocketConn) {
+		conn.WriteMessage(TextMessage, []byte("hi "+ctx.PathValue("name")))
+	}
+	h.WebSocket("/same-origin/:name", handler)
+	h.WebSocket("/cross-origin/:name", handler, WebSocketWithOrigins("https://app.example.com"))
+	h.WebSocket("/private/:name", handler, WebSocketWithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.Header.Get("Authorization") != "Bearer token" {
+				ctx.Resp.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(ctx)
+		}
+	}))
+	server := httptest.NewServer(h)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	testCases := []struct {
+		caseName string
+		path     string
+		header   http.Header
+		wantCode int
+	}{
+		{caseName: "No origin", path: "/same-origin/tom", wantCode: http.StatusSwitchingProtocols},
+		{caseName: "Same origin", path: "/same-origin/tom", header: http.Header{"Origin": {"http://" + host}},
+			wantCode: http.StatusSwitchingProtocols},
+		{caseName: "Other origin", path: "/same-origin/tom", header: http.Header{"Origin": {"https://evil.com"}},
+			wantCode: http.StatusForbidden},
+		{caseName: "Allowed origin", path: "/cross-origin/tom", header: http.Header{"Origin": {"https://app.example.com"}},
+			wantCode: http.StatusSwitchingProtocols},
+		{caseName: "Unauthorized", path: "/private/tom", wantCode: http.StatusUnauthorized},
+		{caseName: "Authorized", path: "/private/tom", header: http.Header{"Authorization": {"Bearer token"}},
+			wantCode: http.StatusSwitchingProtocols},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			conn, resp, err := DialWebSocket(context.Background(), "ws://"+host+tc.path, tc.header)
+			require.NotNil(t, resp)
+			assert.Equal(t, tc.wantCode, resp.StatusCode)
+			if tc.wantCode != http.StatusSwitchingProtocols {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close(CloseNormalClosure, "")
+			_, msg, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, "hi tom", string(msg))
+		})
+	}
+
+	// not a handshake
+	resp, err := http.Get(server.URL + "/same-origin/tom")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/same-origin/tom", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	assert.Equal(t, "13", resp.Header.Get("Sec-WebSocket-Version"))
+}
+
+// Test: a client answering pings is kept, a silent one is dropped
+func TestHTTPServer_WebSocketKeepalive(t *testing.T) {
+	closed := make(chan error, 1)
+	server := newWebSocketServer(t, closed, WebSocketWithPingInterval(10*time.Millisecond))
+
+	// answering pings by reading
+	conn, _, err := DialWebSocket(context.Background(), server.URL+"/echo", nil)
+	require.NoError(t, err)
+	messages := make(chan string, 1)
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				close(messages)
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, conn.WriteMessage(TextMessage, []byte("still here")))
+	assert.Equal(t, "still here", <-messages)
+	conn.Close(CloseNormalClosure, "")
+	<-closed
+
+	// silent
+	conn, _, err = DialWebSocket(context.Background(), server.URL+"/echo", nil)
+	require.NoError(t, err)
+	defer conn.Close(CloseNormalClosure, "")
+	assert.Error(t, <-closed)
+}